@@ -11,6 +11,7 @@ import (
 	"github.com/HadeZForge/FortiFi/internal/cli/handlers"
 	"github.com/HadeZForge/FortiFi/internal/cli/utils"
 	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/payees"
 	"github.com/HadeZForge/FortiFi/internal/types"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -35,6 +36,11 @@ func main() {
 
 	database.InitTables(db)
 
+	// Give a payee to transactions stored before payees existed
+	if _, err := payees.AssignMissing(db); err != nil {
+		utils.PrintWarning("finding payees", err)
+	}
+
 	// Check and create missing monthly budget instances
 	if err := database.CheckAndCreateMissingMonthlyInstances(db); err != nil {
 		utils.PrintWarning("checking for missing monthly budget instances", err)
@@ -86,6 +92,12 @@ func main() {
 			Description: "Show account balance history over time for accounts with balance tracking",
 			Handler:     handlers.AccountBalanceHistoryCLI,
 		},
+		{
+			Tag:         "top",
+			Name:        "Report 	- Top Merchants",
+			Description: "Rank payees by spend or number of visits over an optional date range",
+			Handler:     handlers.TopMerchantsCLI,
+		},
 		{
 			Tag:         "ade",
 			Name:        "Category 	- Add Exact Rule",
@@ -98,6 +110,60 @@ func main() {
 			Description: "Add a new rule for transactions containing a keyword. This will be used for future imports and updates the current database.",
 			Handler:     handlers.UpdateCategoryIncludesCLI,
 		},
+		{
+			Tag:         "rul",
+			Name:        "Category 	- Add Rule",
+			Description: "Add a rule with conditions (description, amount, account, dates, income or expense) and actions (category, rename, tag, transfer, ignore). Applies to future imports and the current database.",
+			Handler:     handlers.AddRuleCLI,
+		},
+		{
+			Tag:         "sug",
+			Name:        "Category 	- Suggest Rules",
+			Description: "Group Uncategorized transactions by payee and propose an exact or includes rule for each group. Accept one by entering a category number",
+			Handler:     handlers.SuggestRulesCLI,
+		},
+		{
+			Tag:         "lsr",
+			Name:        "Category 	- List Rules",
+			Description: "List or search rules in the order they are checked, with how many transactions each matches and categorizes",
+			Handler:     handlers.ListRulesCLI,
+		},
+		{
+			Tag:         "edr",
+			Name:        "Category 	- Edit Rule",
+			Description: "Change the description text or the category of a rule and apply it to the current database",
+			Handler:     handlers.EditRuleCLI,
+		},
+		{
+			Tag:         "dlr",
+			Name:        "Category 	- Delete Rule",
+			Description: "Delete a rule, optionally moving the transactions it categorized back to Uncategorized",
+			Handler:     handlers.DeleteRuleCLI,
+		},
+		{
+			Tag:         "ddr",
+			Name:        "Category 	- Dead Rules",
+			Description: "Find rules that match no transaction and optionally delete them",
+			Handler:     handlers.DeadRulesCLI,
+		},
+		{
+			Tag:         "rec",
+			Name:        "Category 	- Recategorize",
+			Description: "Run every rule again over all transactions, a date range, an account or Uncategorized only. Keeps categories set by hand and shows the changes before applying them",
+			Handler:     handlers.RecategorizeCLI,
+		},
+		{
+			Tag:         "pay",
+			Name:        "Category 	- Payees",
+			Description: "List payees, rename or merge them, and manage the aliases and rewrites that turn descriptions into payees",
+			Handler:     handlers.PayeesCLI,
+		},
+		{
+			Tag:         "cpa",
+			Name:        "Category 	- Set Parent",
+			Description: "Nest a category under a parent category, or move it back to the top level",
+			Handler:     handlers.SetCategoryParentCLI,
+		},
 		{
 			Tag:         "dca",
 			Name:        "Category 	- Delete Category",
@@ -146,17 +212,66 @@ func main() {
 			Description: "Delete transaction(s) by ID or category",
 			Handler:     handlers.DeleteTransactionCLI,
 		},
+		{
+			Tag:         "tri",
+			Name:        "Transaction 	- Triage Uncategorized",
+			Description: "Walk through Uncategorized transactions one by one to categorize, create rules, split, skip or delete them",
+			Handler:     handlers.TriageCLI,
+		},
+		{
+			Tag:         "why",
+			Name:        "Transaction 	- Explain Category",
+			Description: "Show what assigned a transaction's category and when, and every rule that matches it. Type 'why <txn-id>' to skip the prompt, any unique start of the ID works",
+			Handler:     handlers.ExplainCategoryCLI,
+			ArgHandler:  handlers.ExplainTransactionCLI,
+		},
 		{
 			Tag:         "spl",
 			Name:        "Transaction 	- Split Transaction",
 			Description: "Split a transaction into two parts with different categories",
 			Handler:     handlers.SplitTransactionCLI,
 		},
+		{
+			Tag:         "fnd",
+			Name:        "Transaction 	- Search Transactions",
+			Description: "Find transactions by text in their description or metadata fields",
+			Handler:     handlers.SearchTransactionsCLI,
+		},
+		{
+			Tag:         "trf",
+			Name:        "Transaction 	- Transfers",
+			Description: "Link transfers between your accounts so they don't count as income or spend, and confirm or break each pairing",
+			Handler:     func(db *sql.DB, reader *bufio.Reader) { handlers.TransfersCLI(db, reader, config) },
+		},
 		{
 			Tag:         "ing",
-			Name:        "Data 		- Ingest CSV",
-			Description: "Import CSV files (single file or all files in ./raw/ directory)",
-			Handler:     handlers.IngestDataCLI,
+			Name:        "Data 		- Ingest Files",
+			Description: "Import CSV, OFX, QFX, QIF or camt XML files (single file or all files in the raw directory)",
+			Handler:     func(db *sql.DB, reader *bufio.Reader) { handlers.IngestDataCLI(db, reader, config) },
+		},
+		{
+			Tag:         "wat",
+			Name:        "Data 		- Watch Raw Folder",
+			Description: "Import new files as they appear in the raw folder, archiving imported files and moving failures to the rejected folder",
+			Handler:     func(db *sql.DB, reader *bufio.Reader) { handlers.WatchRawDirectoryCLI(db, reader, config) },
+		},
+		{
+			Tag:         "imh",
+			Name:        "Data 		- Import History",
+			Description: "List past imports with their file, format, account and counts",
+			Handler:     handlers.ImportHistoryCLI,
+		},
+		{
+			Tag:         "und",
+			Name:        "Data 		- Undo Import",
+			Description: "Remove every transaction and balance snapshot created by a past import",
+			Handler:     handlers.UndoImportCLI,
+		},
+		{
+			Tag:         "dup",
+			Name:        "Data 		- Find Duplicates",
+			Description: "Find transactions that look like the same purchase (e.g. pending and posted) and merge, skip or keep them",
+			Handler:     handlers.FindDuplicatesCLI,
 		},
 		{
 			Tag:         "cdb",
@@ -199,7 +314,17 @@ func main() {
 		input, _ := reader.ReadString('\n')
 		input = strings.TrimSpace(strings.ToLower(input))
 
-		if cmd, exists := commandMap[input]; exists {
+		// Some commands take an argument on the same line, as in "why 1a2b3c4d"
+		tag, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+
+		if cmd, exists := commandMap[tag]; exists && (arg == "" || cmd.ArgHandler != nil) {
+			if arg != "" {
+				utils.DisplayHeaderWithClear(config.DatabasePath)
+				cmd.ArgHandler(db, reader, arg)
+				utils.WaitForEnter(reader)
+				continue
+			}
 			if cmd.Tag == "ext" {
 				fmt.Println("Exiting...")
 				return
@@ -221,7 +346,11 @@ func main() {
 
 func loadConfig() (*types.Config, error) {
 	config := &types.Config{
-		DatabasePath: "./FortiFi.db", // Default database path
+		DatabasePath:       "./FortiFi.db", // Default database path
+		RawDirectory:       "./raw/",
+		ArchiveDirectory:   "./archive/",
+		RejectedDirectory:  "./rejected/",
+		TransferWindowDays: 5,
 	}
 
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
@@ -300,6 +429,9 @@ func changeDatabaseCLI(currentDB **sql.DB, reader *bufio.Reader, config *types.C
 
 	// Initialize tables in the new database
 	database.InitTables(newDB)
+	if _, err := payees.AssignMissing(newDB); err != nil {
+		utils.PrintWarning("finding payees", err)
+	}
 
 	// Update the database reference
 	*currentDB = newDB
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// AddRuleCLI walks through the conditions and actions of a new rule, stores it and applies it to existing transactions
+func AddRuleCLI(db *sql.DB, reader *bufio.Reader) {
+	fmt.Println("=== Add Rule ===")
+	fmt.Println("Leave any condition blank to skip it. A transaction has to meet every condition you set.")
+
+	rule, err := promptRule(db, reader)
+	if err != nil {
+		utils.PrintError("reading rule", err)
+		return
+	}
+
+	if err := rules.Validate(rule); err != nil {
+		utils.PrintError("validating rule", err)
+		return
+	}
+
+	fmt.Printf("\nIf %s\nthen %s\n", rules.Describe(rule), rules.DescribeActions(rule))
+	confirmed, err := confirmRulePreview(db, reader, rule, "Save this rule and apply it to existing transactions?")
+	if err != nil {
+		utils.PrintError("previewing rule", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Rule discarded.")
+		return
+	}
+
+	ruleID, err := database.InsertRule(db, rule)
+	if err != nil {
+		utils.PrintError("saving rule", err)
+		return
+	}
+
+	changed, err := rules.ApplyRule(db, ruleID)
+	if err != nil {
+		utils.PrintError("applying rule", err)
+		return
+	}
+
+	fmt.Printf(" Saved rule %d and updated %d existing transaction(s)\n", ruleID, changed)
+}
+
+// rulePreviewRows is how many transactions of each group the rule preview shows
+const rulePreviewRows = 10
+
+// confirmRulePreview shows the existing transactions a rule would move to its category, listing those leaving
+// Uncategorized apart from those taken from another category, then asks the user to confirm
+func confirmRulePreview(db *sql.DB, reader *bufio.Reader, rule types.Rule, prompt string) (bool, error) {
+	preview, err := rules.PreviewRule(db, rule)
+	if err != nil {
+		return false, err
+	}
+
+	groups := []struct {
+		title        string
+		transactions []types.TableTransaction
+	}{
+		{"Moving out of Uncategorized", preview.FromUncategorized},
+		{"Moving from other categories", preview.FromOtherCategories},
+	}
+	for _, group := range groups {
+		if len(group.transactions) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s (%d):\n", group.title, len(group.transactions))
+		shown := group.transactions[:min(len(group.transactions), rulePreviewRows)]
+		if err := utils.PrintTransactionTable(db, shown, true); err != nil {
+			return false, err
+		}
+		if len(group.transactions) > rulePreviewRows {
+			fmt.Printf("  ... and %d more transactions\n", len(group.transactions)-rulePreviewRows)
+		}
+	}
+	if preview.Renamed > 0 {
+		fmt.Printf("\n%d transaction(s) would be renamed\n", preview.Renamed)
+	}
+	if len(preview.FromUncategorized) == 0 && len(preview.FromOtherCategories) == 0 && preview.Renamed == 0 {
+		fmt.Println("\nNo existing transactions would change category.")
+	}
+
+	return utils.ConfirmAction(reader, "\n"+prompt)
+}
+
+// promptRule asks for each condition and action of a rule
+func promptRule(db *sql.DB, reader *bufio.Reader) (types.Rule, error) {
+	rule := types.Rule{Priority: database.IncludesRulePriority}
+	c, a := &rule.Conditions, &rule.Actions
+
+	// Conditions
+	matchType, err := utils.PromptInput(reader, "\nDescription match (exact, contains, starts, regex): ")
+	if err != nil {
+		return rule, err
+	}
+	if matchType != "" {
+		text, err := utils.PromptInput(reader, "Description text: ")
+		if err != nil {
+			return rule, err
+		}
+		switch strings.ToLower(matchType) {
+		case "exact":
+			c.DescriptionExact = text
+		case "contains":
+			c.DescriptionContains = text
+		case "starts":
+			c.DescriptionStartsWith = text
+		case "regex":
+			c.DescriptionRegex = text
+		default:
+			return rule, fmt.Errorf("unknown description match '%s'", matchType)
+		}
+
+		if c.CaseInsensitive, err = utils.ConfirmAction(reader, "Ignore upper/lower case?"); err != nil {
+			return rule, err
+		}
+	}
+
+	if c.AmountMin, err = promptOptionalAmount(reader, "Minimum amount (e.g. -100): "); err != nil {
+		return rule, err
+	}
+	if c.AmountMax, err = promptOptionalAmount(reader, "Maximum amount (e.g. -10): "); err != nil {
+		return rule, err
+	}
+
+	if c.Direction, err = utils.PromptInput(reader, "Only income or expense (income, expense): "); err != nil {
+		return rule, err
+	}
+	c.Direction = strings.ToLower(c.Direction)
+
+	limitAccount, err := utils.ConfirmAction(reader, "Limit to one account?")
+	if err != nil {
+		return rule, err
+	}
+	if limitAccount {
+		accounts, err := utils.GetAvailableAccounts(db)
+		if err != nil {
+			return rule, err
+		}
+		if c.AccountID, c.AccountName, err = utils.SelectAccount(reader, accounts); err != nil {
+			return rule, err
+		}
+	}
+
+	if c.PayeeName, err = utils.PromptInput(reader, "Payee name: "); err != nil {
+		return rule, err
+	}
+	if c.PayeeName != "" {
+		if c.PayeeID, err = database.FindPayee(db, c.PayeeName); err != nil {
+			return rule, err
+		}
+		if c.PayeeID == 0 {
+			return rule, fmt.Errorf("no payee named '%s', the pay command lists them", c.PayeeName)
+		}
+	}
+
+	if c.DateFrom, err = promptOptionalDate(reader, "First date (YYYY-MM-DD): "); err != nil {
+		return rule, err
+	}
+	if c.DateTo, err = promptOptionalDate(reader, "Last date (YYYY-MM-DD): "); err != nil {
+		return rule, err
+	}
+
+	// Actions
+	setCategory, err := utils.ConfirmAction(reader, "\nSet the category?")
+	if err != nil {
+		return rule, err
+	}
+	if setCategory {
+		categories, err := utils.GetAvailableCategories(db)
+		if err != nil {
+			return rule, err
+		}
+		if a.CategoryID, a.CategoryName, err = utils.SelectCategory(db, reader, categories, true); err != nil {
+			return rule, err
+		}
+	}
+
+	if a.RewriteDescription, err = utils.PromptInput(reader, "Rename the description to: "); err != nil {
+		return rule, err
+	}
+	if a.Tag, err = utils.PromptInput(reader, "Add tag: "); err != nil {
+		return rule, err
+	}
+	if a.MarkTransfer, err = utils.ConfirmAction(reader, "Mark as a transfer between accounts?"); err != nil {
+		return rule, err
+	}
+	if a.IgnoreTransaction, err = utils.ConfirmAction(reader, "Ignore matching transactions when importing?"); err != nil {
+		return rule, err
+	}
+
+	priorityInput, err := utils.PromptInput(reader, fmt.Sprintf("Priority, higher is checked first (default %d): ", rule.Priority))
+	if err != nil {
+		return rule, err
+	}
+	if priorityInput != "" {
+		if rule.Priority, err = strconv.Atoi(priorityInput); err != nil {
+			return rule, fmt.Errorf("invalid priority '%s'", priorityInput)
+		}
+	}
+
+	return rule, nil
+}
+
+// promptOptionalAmount reads an amount, returning nil when the input is blank
+func promptOptionalAmount(reader *bufio.Reader, prompt string) (*float64, error) {
+	input, err := utils.PromptInput(reader, prompt)
+	if err != nil || input == "" {
+		return nil, err
+	}
+	amount, err := strconv.ParseFloat(input, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount '%s'", input)
+	}
+	return &amount, nil
+}
+
+// promptOptionalDate reads a YYYY-MM-DD date, returning nil when the input is blank
+func promptOptionalDate(reader *bufio.Reader, prompt string) (*time.Time, error) {
+	input, err := utils.PromptInput(reader, prompt)
+	if err != nil || input == "" {
+		return nil, err
+	}
+	date, err := time.Parse("2006-01-02", input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%s'", input)
+	}
+	return &date, nil
+}
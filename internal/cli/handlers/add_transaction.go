@@ -10,6 +10,7 @@ import (
 
 	cliUtils "github.com/HadeZForge/FortiFi/internal/cli/utils"
 	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/payees"
 	txnUtils "github.com/HadeZForge/FortiFi/internal/transaction/utils"
 	"github.com/HadeZForge/FortiFi/internal/types"
 	_ "github.com/mattn/go-sqlite3"
@@ -100,20 +101,21 @@ func AddTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	}
 
 	// Generate transaction ID with daily sequence
-	newTransaction.Id = txnUtils.GenerateTransactionHash(
+	fingerprint := txnUtils.GenerateTransactionHash(
 		parsedDate,
 		newTransaction.Amount,
 		newTransaction.Description,
 		0)
+	newTransaction.Id = txnUtils.GenerateTransactionID(accountID, fingerprint)
 
 	// Check if transaction already exists
-	exists, err := database.TransactionExists(db, newTransaction.Id)
+	existingID, err := database.FindTransactionByFingerprint(db, accountID, fingerprint)
 	if err != nil {
 		cliUtils.PrintError("checking transaction existence", err)
 		return
 	}
-	if exists {
-		fmt.Printf("Transaction already exists, skipping: %s\n", newTransaction.Id[:8])
+	if existingID != "" {
+		fmt.Printf("Transaction already exists, skipping: %s\n", existingID[:8])
 		return
 	}
 
@@ -136,13 +138,18 @@ func AddTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	}
 
 	// Insert transaction
-	query := `INSERT INTO transactions (id, account_id, category_id, amount, transaction_date, description) 
-				VALUES (?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO transactions (id, account_id, category_id, amount, transaction_date, description, import_fingerprint,
+				category_source, category_reason, category_decided_at) 
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`
 
-	_, err = db.Exec(query, newTransaction.Id, accountID, newTransaction.CategoryID, newTransaction.Amount, newTransaction.Date, newTransaction.Description)
+	_, err = db.Exec(query, newTransaction.Id, accountID, newTransaction.CategoryID, newTransaction.Amount, newTransaction.Date, newTransaction.Description, fingerprint,
+		types.CategorySourceManual, "added with add")
 	if err != nil {
 		cliUtils.PrintError("inserting transaction", err)
 		return
 	}
+	if _, err := payees.AssignMissing(db); err != nil {
+		cliUtils.PrintWarning("finding payee", err)
+	}
 	fmt.Println("Transaction added successfully.")
 }
@@ -25,14 +25,35 @@ func CategoryTimelineCLI(db *sql.DB, reader *bufio.Reader) {
 	}
 
 	// Use the new util code to let the user select a category
-	_, categoryName, err := utils.SelectCategory(db, reader, categories, false)
+	categoryID, categoryName, err := utils.SelectCategory(db, reader, categories, false)
 	if err != nil {
 		utils.PrintError("selecting category", err)
 		return
 	}
 
+	// A parent category can be shown on its own or with the subcategories below the chosen level rolled into it
+	categoryIDs := []int{categoryID}
+	tree, err := utils.LoadCategoryTree(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+	if descendants := tree.Descendants(categoryID); len(descendants) > 0 {
+		level, err := utils.PromptCategoryLevel(reader, tree)
+		if err != nil {
+			utils.PrintError("reading category level", err)
+			return
+		}
+		rollup := tree.Rollup(categoryID, level)
+		for _, id := range descendants {
+			if tree.Rollup(id, level) == rollup {
+				categoryIDs = append(categoryIDs, id)
+			}
+		}
+	}
+
 	// Get category timeline data
-	timeline, avgMonthlySpend, err := getCategoryTimeline(db, categoryName)
+	timeline, avgMonthlySpend, err := getCategoryTimeline(db, categoryIDs)
 	if err != nil {
 		utils.PrintError("retrieving category timeline", err)
 		return
@@ -79,19 +100,24 @@ func CategoryTimelineCLI(db *sql.DB, reader *bufio.Reader) {
 	fmt.Printf("\nTotal months: %d\n", len(timeline))
 }
 
-func getCategoryTimeline(db *sql.DB, categoryName string) ([]types.TimelineEntry, float64, error) {
-	query := `
+func getCategoryTimeline(db *sql.DB, categoryIDs []int) ([]types.TimelineEntry, float64, error) {
+	placeholders := strings.Repeat("?,", len(categoryIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	query := fmt.Sprintf(`
 		SELECT 
-			strftime('%Y-%m', t.transaction_date) as month,
+			strftime('%%Y-%%m', t.transaction_date) as month,
 			SUM(t.amount) as total
 		FROM transactions t
-		JOIN categories c ON t.category_id = c.id
-		WHERE c.name = ?
-		GROUP BY strftime('%Y-%m', t.transaction_date)
+		WHERE t.category_id IN (%s)
+		GROUP BY strftime('%%Y-%%m', t.transaction_date)
 		ORDER BY month ASC
-	`
+	`, placeholders)
 
-	rows, err := db.Query(query, categoryName)
+	args := make([]any, len(categoryIDs))
+	for i, id := range categoryIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
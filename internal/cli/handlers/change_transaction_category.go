@@ -28,9 +28,9 @@ func ChangeTransactionCategoryCLI(db *sql.DB, reader *bufio.Reader) {
 	rows, err := db.Query(`
 		SELECT t.id, t.transaction_date, t.Amount, t.description, t.category_id
 		FROM transactions t
-		WHERE t.id LIKE ? || '%'
+		WHERE t.id LIKE ? || '%' OR t.import_fingerprint LIKE ? || '%'
 		ORDER BY t.transaction_date DESC
-	`, shortIDInput)
+	`, shortIDInput, shortIDInput)
 	if err != nil {
 		utils.PrintError("retrieving transactions", err)
 		return
@@ -99,7 +99,8 @@ func ChangeTransactionCategoryCLI(db *sql.DB, reader *bufio.Reader) {
 	}
 
 	// Update the transaction
-	_, err = db.Exec(`UPDATE transactions SET Category_id = ? WHERE id = ?`, newCategoryID, selectedTxn.Id)
+	decision := types.CategoryDecision{Source: types.CategorySourceManual, Reason: "changed with chg"}
+	err = database.SetTransactionCategory(db, selectedTxn.Id, newCategoryID, decision)
 	if err != nil {
 		utils.PrintError("updating transaction", err)
 		return
@@ -115,12 +116,11 @@ func displayTransaction(db *sql.DB, t types.TableTransaction) {
 	if catErr != nil {
 		categoryName = fmt.Sprintf("(ID %d)", t.CategoryID)
 	}
-	if err != nil {
-		fmt.Printf("ID: %s | Date: %s | Amount: %s | Category: %s | Description: %s\n",
-			t.Id[:8], t.Date, utils.FormatAmount(t.Amount), categoryName, utils.Truncate(t.Description, 40))
-		return
+	formattedDate := t.Date
+	if err == nil {
+		formattedDate = parsedDate.Format("01-02-06")
 	}
-	formattedDate := parsedDate.Format("01-02-06")
 	fmt.Printf("ID: %s | Date: %s | Amount: %s | Category: %s | Description: %s\n",
 		t.Id[:8], formattedDate, utils.FormatAmount(t.Amount), categoryName, utils.Truncate(t.Description, 40))
+	utils.PrintTransactionMetadata(db, t.Id)
 }
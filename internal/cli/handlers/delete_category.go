@@ -191,12 +191,28 @@ func handleMoveToUncategorized(db *sql.DB, reader *bufio.Reader, categoryID int,
 	}()
 
 	// Move transactions to uncategorized
-	result, err := tx.Exec(`UPDATE transactions SET category_id = ? WHERE category_id = ?`, uncategorizedID, categoryID)
+	result, err := tx.Exec(`
+		UPDATE transactions
+		SET category_id = ?, category_source = ?, category_rule_id = NULL, category_reason = ?, category_decided_at = CURRENT_TIMESTAMP
+		WHERE category_id = ?
+	`, uncategorizedID, types.CategorySourceDefault, fmt.Sprintf("category '%s' was deleted", categoryName), categoryID)
 	if err != nil {
 		utils.PrintError("moving transactions to uncategorized", err)
 		return
 	}
 
+	// Rules can't point at a deleted category
+	if err = database.DeleteCategoryRules(tx, categoryID); err != nil {
+		utils.PrintError("removing category from rules", err)
+		return
+	}
+
+	// Subcategories move up a level
+	if err = database.ReparentCategoryChildren(tx, categoryID); err != nil {
+		utils.PrintError("moving subcategories", err)
+		return
+	}
+
 	// Delete the category
 	_, err = tx.Exec(`DELETE FROM categories WHERE id = ?`, categoryID)
 	if err != nil {
@@ -259,6 +275,24 @@ func confirmCategoryDeletion(db *sql.DB, reader *bufio.Reader, categoryID int, c
 		fmt.Printf("Deleted %d transaction(s) from category '%s'\n", rowsAffected, categoryName)
 	}
 
+	// Remove metadata and other data left behind by the deleted transactions
+	if err = database.DeleteOrphanedTransactionData(tx); err != nil {
+		utils.PrintError("cleaning up transaction data", err)
+		return
+	}
+
+	// Rules can't point at a deleted category
+	if err = database.DeleteCategoryRules(tx, categoryID); err != nil {
+		utils.PrintError("removing category from rules", err)
+		return
+	}
+
+	// Subcategories move up a level
+	if err = database.ReparentCategoryChildren(tx, categoryID); err != nil {
+		utils.PrintError("moving subcategories", err)
+		return
+	}
+
 	// Delete the category
 	result, err := tx.Exec(`DELETE FROM categories WHERE id = ?`, categoryID)
 	if err != nil {
@@ -51,9 +51,9 @@ func deleteByTransactionID(db *sql.DB, reader *bufio.Reader) {
 	rows, err := db.Query(`
 		SELECT t.id, t.transaction_date, t.amount, t.description, t.category_id
 		FROM transactions t
-		WHERE t.id LIKE ? || '%'
+		WHERE t.id LIKE ? || '%' OR t.import_fingerprint LIKE ? || '%'
 		ORDER BY t.transaction_date DESC
-	`, shortIDInput)
+	`, shortIDInput, shortIDInput)
 	if err != nil {
 		utils.PrintError("retrieving transactions", err)
 		return
@@ -135,6 +135,10 @@ func deleteByTransactionID(db *sql.DB, reader *bufio.Reader) {
 		return
 	}
 
+	if err := database.DeleteOrphanedTransactionData(db); err != nil {
+		utils.PrintWarning("cleaning up transaction data", err)
+	}
+
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected > 0 {
 		categoryName, err := database.GetCategoryNameByID(db, selectedTxn.CategoryID)
@@ -246,6 +250,10 @@ func deleteByCategory(db *sql.DB, reader *bufio.Reader) {
 		return
 	}
 
+	if err := database.DeleteOrphanedTransactionData(db); err != nil {
+		utils.PrintWarning("cleaning up transaction data", err)
+	}
+
 	rowsAffected, _ := result.RowsAffected()
 	fmt.Printf(" Successfully deleted %d transaction(s) from category '%s'\n", rowsAffected, selectedCategoryName)
 }
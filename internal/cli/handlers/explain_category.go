@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ExplainCategoryCLI asks for a transaction and explains its category
+func ExplainCategoryCLI(db *sql.DB, reader *bufio.Reader) {
+	transaction, err := utils.SelectTransaction(db, reader)
+	if err != nil {
+		utils.PrintError("selecting transaction", err)
+		return
+	}
+	explainCategory(db, transaction)
+}
+
+// ExplainTransactionCLI explains the category of the transaction whose ID starts with the given prefix,
+// as in "why 1a2b3c4d"
+func ExplainTransactionCLI(db *sql.DB, reader *bufio.Reader, idPrefix string) {
+	fullID, err := utils.ResolveTransactionID(db, idPrefix)
+	if err != nil {
+		utils.PrintError("finding transaction", err)
+		return
+	}
+	transaction, err := utils.GetTableTransaction(db, fullID)
+	if err != nil {
+		utils.PrintError("retrieving transaction", err)
+		return
+	}
+	explainCategory(db, transaction)
+}
+
+// explainCategory shows what assigned a transaction's category and when, and every stored rule that matches it
+func explainCategory(db *sql.DB, transaction types.TableTransaction) {
+	fmt.Println()
+	if err := utils.PrintTransactionTable(db, []types.TableTransaction{transaction}, true); err != nil {
+		utils.PrintError("displaying transaction", err)
+		return
+	}
+
+	payeeID, payeeName, err := database.GetTransactionPayee(db, transaction.Id)
+	if err != nil {
+		utils.PrintError("retrieving payee", err)
+		return
+	}
+	if payeeName != "" {
+		fmt.Printf("\nPayee: %s\n", payeeName)
+	}
+
+	decision, err := database.GetCategoryDecision(db, transaction.Id)
+	if err != nil {
+		utils.PrintError("retrieving category decision", err)
+		return
+	}
+
+	ruleList, err := rules.Load(db)
+	if err != nil {
+		utils.PrintError("retrieving rules", err)
+		return
+	}
+
+	fmt.Printf("\nCategory decided by: %s\n", describeDecision(decision, ruleList))
+	if !decision.DecidedAt.IsZero() {
+		fmt.Printf("Decided on: %s\n", decision.DecidedAt.Local().Format("2006-01-02 15:04"))
+	}
+
+	date, err := utils.ParseDate(transaction.Date)
+	if err != nil {
+		utils.PrintError("parsing transaction date", err)
+		return
+	}
+	// Rules match the description the transaction came with, not one a rule rewrote
+	description, err := database.GetOriginalDescription(db, transaction.Id)
+	if err != nil {
+		utils.PrintError("retrieving description", err)
+		return
+	}
+	result := rules.Evaluate(ruleList, rules.Transaction{
+		AccountID:   transaction.AccountID,
+		Date:        date,
+		Amount:      transaction.Amount,
+		Description: description,
+		PayeeID:     payeeID,
+	})
+
+	if len(result.Matched) == 0 {
+		fmt.Println("\nNo stored rules match this transaction.")
+		return
+	}
+
+	fmt.Printf("\nRules matching this transaction, in the order they are checked (%d):\n", len(result.Matched))
+	for _, rule := range result.Matched {
+		note := ""
+		if result.CategoryRule != nil && result.CategoryRule.ID == rule.ID {
+			note = " <- decides the category"
+		}
+		fmt.Printf("  %s, priority %d: %s%s\n", rules.Label(rule), rule.Priority, rules.DescribeActions(rule), note)
+	}
+
+	if result.CategoryRule != nil && result.CategoryID != transaction.CategoryID {
+		fmt.Printf("\nThe rules would now put this transaction in '%s'\n", result.CategoryRule.Actions.CategoryName)
+	}
+}
+
+// describeDecision explains a category decision in words, noting rules that have since been deleted
+func describeDecision(decision types.CategoryDecision, ruleList []types.Rule) string {
+	switch decision.Source {
+	case types.CategorySourceSpecialRule:
+		return decision.Reason + " in the import config"
+	case types.CategorySourceFile:
+		return "the category in the imported file"
+	case types.CategorySourceRule:
+		for _, rule := range ruleList {
+			if rule.ID == decision.RuleID {
+				return decision.Reason
+			}
+		}
+		return decision.Reason + ", since deleted"
+	case types.CategorySourceDefault:
+		if decision.Reason == "default" {
+			return "no rule matched, so it went to Uncategorized"
+		}
+		return "moved to Uncategorized, " + decision.Reason
+	case types.CategorySourceManual:
+		return "set by hand, " + decision.Reason
+	}
+	return "not recorded, the transaction was categorized before decisions were kept"
+}
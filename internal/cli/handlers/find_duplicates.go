@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/importservice"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// FindDuplicatesCLI scans stored transactions for probable duplicates and lets the user resolve each pair
+func FindDuplicatesCLI(db *sql.DB, reader *bufio.Reader) {
+	prompt := fmt.Sprintf("Days apart duplicates can be (default %d): ", importservice.DefaultDuplicateWindowDays)
+	input, err := utils.PromptInput(reader, prompt)
+	if err != nil {
+		utils.PrintError("reading window", err)
+		return
+	}
+
+	windowDays := importservice.DefaultDuplicateWindowDays
+	if input != "" {
+		windowDays, err = strconv.Atoi(input)
+		if err != nil || windowDays < 0 {
+			fmt.Println("Invalid number of days.")
+			return
+		}
+	}
+
+	pairs, err := database.ScanProbableDuplicates(db, windowDays)
+	if err != nil {
+		utils.PrintError("scanning for duplicates", err)
+		return
+	}
+
+	if len(pairs) == 0 {
+		fmt.Println("No probable duplicates found.")
+		return
+	}
+
+	fmt.Printf("Found %d probable duplicate pair(s)\n", len(pairs))
+	resolveDuplicatePairs(db, reader, pairs)
+}
+
+// resolveDuplicatePairs asks the user what to do with each probable duplicate pair. Merging keeps the
+// existing transaction with the duplicate's date and description, skipping deletes the duplicate and
+// keeping both stops the pair from being reported again. Pairs left undecided are reported next time
+func resolveDuplicatePairs(db *sql.DB, reader *bufio.Reader, pairs []types.DuplicatePair) {
+	removed := make(map[string]bool)
+	for i, pair := range pairs {
+		// An earlier merge may already have removed one side of this pair
+		if removed[pair.Existing.Id] || removed[pair.Duplicate.Id] {
+			continue
+		}
+
+		fmt.Printf("\n=== Probable duplicate %d of %d (%.0f%% similar) ===\n", i+1, len(pairs), pair.Similarity*100)
+		fmt.Println("Existing:")
+		if err := utils.PrintTransactionTable(db, []types.TableTransaction{pair.Existing}, false); err != nil {
+			utils.PrintError("displaying transaction", err)
+			continue
+		}
+		fmt.Println("Duplicate:")
+		if err := utils.PrintTransactionTable(db, []types.TableTransaction{pair.Duplicate}, false); err != nil {
+			utils.PrintError("displaying transaction", err)
+			continue
+		}
+
+		fmt.Println("(m) Merge - keep the existing transaction with the duplicate's date and description")
+		fmt.Println("(s) Skip - delete the duplicate")
+		fmt.Println("(k) Keep both - they are different transactions")
+		fmt.Println("(q) Stop reviewing")
+		choice, err := utils.PromptInput(reader, "Choose an option (Enter to decide later): ")
+		if err != nil {
+			utils.PrintError("reading choice", err)
+			return
+		}
+
+		switch strings.ToLower(choice) {
+		case "m":
+			if err := database.MergeTransactions(db, pair.Existing.Id, pair.Duplicate.Id, true); err != nil {
+				utils.PrintError("merging transactions", err)
+				continue
+			}
+			removed[pair.Duplicate.Id] = true
+			fmt.Printf(" Merged %s into %s\n", pair.Duplicate.Id[:8], pair.Existing.Id[:8])
+		case "s":
+			if err := database.MergeTransactions(db, pair.Existing.Id, pair.Duplicate.Id, false); err != nil {
+				utils.PrintError("removing duplicate", err)
+				continue
+			}
+			removed[pair.Duplicate.Id] = true
+			fmt.Printf(" Removed duplicate %s\n", pair.Duplicate.Id[:8])
+		case "k":
+			if err := database.DismissDuplicate(db, pair.Existing.Id, pair.Duplicate.Id); err != nil {
+				utils.PrintError("keeping both transactions", err)
+				continue
+			}
+			fmt.Println(" Kept both transactions")
+		case "q":
+			return
+		default:
+			fmt.Println("Left for later")
+		}
+	}
+}
@@ -26,10 +26,30 @@ func GenerateMonthReportCLI(db *sql.DB, reader *bufio.Reader) {
 
 	datePrefix := fmt.Sprintf("%s-%s", yearInput, monthInput)
 
+	byPayee, err := utils.PromptSummaryByPayee(reader)
+	if err != nil {
+		utils.PrintError("reading summary choice", err)
+		return
+	}
+	tree, err := utils.LoadCategoryTree(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+	level := 0
+	if !byPayee {
+		if level, err = utils.PromptCategoryLevel(reader, tree); err != nil {
+			utils.PrintError("reading category level", err)
+			return
+		}
+	}
+
 	rows, err := db.Query(`
-		SELECT t.id, t.transaction_date, t.amount, t.description, c.name
+		SELECT t.id, t.transaction_date, t.amount, t.description, c.id, c.name, COALESCE(p.name, ''),
+		       t.id IN (SELECT transaction_id FROM transfer_transactions)
 		FROM transactions t
 		JOIN categories c ON t.category_id = c.id
+		LEFT JOIN payees p ON p.id = t.payee_id
 		WHERE t.transaction_date LIKE ? || '%'
 		ORDER BY t.transaction_date ASC
 	`, datePrefix)
@@ -44,7 +64,10 @@ func GenerateMonthReportCLI(db *sql.DB, reader *bufio.Reader) {
 		date        string
 		amount      float64
 		description string
+		categoryID  int
 		category    string
+		payee       string
+		transfer    bool
 	}
 
 	var entries []entry
@@ -53,13 +76,23 @@ func GenerateMonthReportCLI(db *sql.DB, reader *bufio.Reader) {
 
 	for rows.Next() {
 		var e entry
-		err := rows.Scan(&e.id, &e.date, &e.amount, &e.description, &e.category)
+		err := rows.Scan(&e.id, &e.date, &e.amount, &e.description, &e.categoryID, &e.category, &e.payee, &e.transfer)
 		if err != nil {
 			utils.PrintError("reading row", err)
 			return
 		}
 		entries = append(entries, e)
-		totals[e.category] += e.amount
+
+		// Transfers between accounts are neither income nor spend
+		if e.transfer {
+			continue
+		}
+		// Sum by payee, or by category with subcategories under their parent at the chosen level
+		if byPayee {
+			totals[utils.PayeeOrNone(e.payee)] += e.amount
+		} else {
+			totals[tree.Name(tree.Rollup(e.categoryID, level))] += e.amount
+		}
 		// Track income vs spending
 		if e.amount > 0 {
 			totalIncome += e.amount
@@ -83,7 +116,9 @@ func GenerateMonthReportCLI(db *sql.DB, reader *bufio.Reader) {
 
 		// Color category blue if it's "Uncategorized"
 		categoryStr := e.category
-		if strings.ToLower(e.category) == "uncategorized" {
+		if e.transfer {
+			categoryStr = "Transfer"
+		} else if strings.ToLower(e.category) == "uncategorized" {
 			categoryStr = fmt.Sprintf("%s%s%s", utils.Blue, e.category, utils.Reset)
 		}
 
@@ -106,7 +141,11 @@ func GenerateMonthReportCLI(db *sql.DB, reader *bufio.Reader) {
 	fmt.Printf("Total Spend     : %s\n", utils.FormatAmount(totalSpend))
 	fmt.Printf("Net Gain/Loss   : %s\n", utils.FormatAmount(netGainLoss))
 
-	fmt.Println("\nCategory Summary:")
+	if byPayee {
+		fmt.Println("\nPayee Summary:")
+	} else {
+		fmt.Println("\nCategory Summary:")
+	}
 	for cat, amt := range totals {
 		fmt.Printf("%-15s : %-8s\n", cat, utils.FormatAmount(amt))
 	}
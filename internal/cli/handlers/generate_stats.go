@@ -17,22 +17,41 @@ func GenerateStatsCLI(db *sql.DB, reader *bufio.Reader) {
 		return
 	}
 
-	var whereClause string
+	byPayee, err := utils.PromptSummaryByPayee(reader)
+	if err != nil {
+		utils.PrintError("reading summary choice", err)
+		return
+	}
+	tree, err := utils.LoadCategoryTree(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+	level := 0
+	if !byPayee {
+		if level, err = utils.PromptCategoryLevel(reader, tree); err != nil {
+			utils.PrintError("reading category level", err)
+			return
+		}
+	}
+
+	// Transfers between accounts are neither income nor spend
+	whereClause := "WHERE t.id NOT IN (SELECT transaction_id FROM transfer_transactions)"
 	var timeDescription string
 
 	if strings.ToLower(input) == "all" {
-		whereClause = ""
 		timeDescription = "All Time"
 	} else {
-		whereClause = fmt.Sprintf("WHERE t.transaction_date LIKE '%s%%'", input)
+		whereClause += fmt.Sprintf(" AND t.transaction_date LIKE '%s%%'", input)
 		timeDescription = fmt.Sprintf("Year %s", input)
 	}
 
 	// Query for all transactions with category names
 	query := fmt.Sprintf(`
-		SELECT t.amount, c.name, t.transaction_date
+		SELECT t.amount, c.id, COALESCE(p.name, ''), t.transaction_date
 		FROM transactions t
 		JOIN categories c ON t.category_id = c.id
+		LEFT JOIN payees p ON p.id = t.payee_id
 		%s
 		ORDER BY t.transaction_date ASC
 	`, whereClause)
@@ -56,11 +75,18 @@ func GenerateStatsCLI(db *sql.DB, reader *bufio.Reader) {
 
 	for rows.Next() {
 		var t transaction
-		err := rows.Scan(&t.amount, &t.category, &t.date)
+		var categoryID int
+		var payee string
+		err := rows.Scan(&t.amount, &categoryID, &payee, &t.date)
 		if err != nil {
 			utils.PrintError("reading row", err)
 			return
 		}
+		// Subcategories are counted under their parent at the chosen level
+		t.category = tree.Name(tree.Rollup(categoryID, level))
+		if byPayee {
+			t.category = utils.PayeeOrNone(payee)
+		}
 		transactions = append(transactions, t)
 		categoryTotals[t.category] += t.amount
 
@@ -137,7 +163,11 @@ func GenerateStatsCLI(db *sql.DB, reader *bufio.Reader) {
 	fmt.Printf("Total Spend:  %s\n", utils.FormatAmount(-totalSpend))
 	fmt.Printf("Total Income: %s\n\n", utils.FormatAmount(totalIncome))
 
-	fmt.Println("AVERAGE MONTHLY BREAKDOWN BY CATEGORY:")
+	if byPayee {
+		fmt.Println("AVERAGE MONTHLY BREAKDOWN BY PAYEE:")
+	} else {
+		fmt.Println("AVERAGE MONTHLY BREAKDOWN BY CATEGORY:")
+	}
 	fmt.Println(strings.Repeat("-", 40))
 	for category, avgAmount := range avgCategoryTotals {
 		fmt.Printf("%-20s: %s\n", category, utils.FormatAmount(avgAmount))
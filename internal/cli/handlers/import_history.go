@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ImportHistoryCLI lists every recorded import batch
+func ImportHistoryCLI(db *sql.DB, reader *bufio.Reader) {
+	batches, err := database.GetImportBatches(db)
+	if err != nil {
+		utils.PrintError("retrieving import history", err)
+		return
+	}
+
+	if len(batches) == 0 {
+		fmt.Println("No imports recorded yet.")
+		return
+	}
+
+	fmt.Println("=== Import History ===")
+	displayImportBatches(batches)
+}
+
+// UndoImportCLI removes every transaction and account snapshot created by an import batch
+func UndoImportCLI(db *sql.DB, reader *bufio.Reader) {
+	batches, err := database.GetImportBatches(db)
+	if err != nil {
+		utils.PrintError("retrieving import history", err)
+		return
+	}
+
+	if len(batches) == 0 {
+		fmt.Println("No imports recorded yet.")
+		return
+	}
+
+	fmt.Println("=== Import History ===")
+	displayImportBatches(batches)
+
+	batchInput, err := utils.PromptInput(reader, "\nEnter the batch number to undo: ")
+	if err != nil {
+		utils.PrintError("reading batch number", err)
+		return
+	}
+
+	batchID, err := strconv.Atoi(batchInput)
+	if err != nil {
+		fmt.Println("Invalid batch number.")
+		return
+	}
+
+	var selected *types.ImportBatch
+	for i := range batches {
+		if batches[i].ID == batchID {
+			selected = &batches[i]
+			break
+		}
+	}
+	if selected == nil {
+		fmt.Printf("No import batch found with number %d\n", batchID)
+		return
+	}
+	if selected.RolledBackAt != nil {
+		fmt.Printf("Batch %d was already undone on %s\n", selected.ID, selected.RolledBackAt.Local().Format("2006-01-02 15:04"))
+		return
+	}
+
+	confirmMessage := fmt.Sprintf("Delete %d transaction(s) and %d balance snapshot(s) imported from %s?",
+		selected.TransactionCount, selected.SnapshotCount, selected.FileName)
+	confirmed, err := utils.ConfirmAction(reader, confirmMessage)
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Undo cancelled.")
+		return
+	}
+
+	transactionsDeleted, snapshotsDeleted, err := database.RollbackImportBatch(db, selected.ID)
+	if err != nil {
+		utils.PrintError("undoing import", err)
+		return
+	}
+
+	fmt.Printf(" Undid import batch %d: deleted %d transaction(s) and %d balance snapshot(s)\n",
+		selected.ID, transactionsDeleted, snapshotsDeleted)
+}
+
+// displayImportBatches prints import batches as a table
+func displayImportBatches(batches []types.ImportBatch) {
+	header := []string{"Batch", "Imported", "File", "Format", "Account", "Read", "Skipped", "Added", "Status"}
+	widths := []int{6, 16, 30, 15, 20, 6, 8, 6, 22}
+	fmt.Println(utils.FormatRow(header, widths))
+	fmt.Println(strings.Repeat("-", utils.Sum(widths)+3*(len(widths)-1)))
+
+	for _, batch := range batches {
+		status := "complete"
+		if batch.RolledBackAt != nil {
+			status = "undone " + batch.RolledBackAt.Local().Format("2006-01-02")
+		} else if batch.CompletedAt == nil {
+			status = "incomplete"
+		}
+
+		row := []string{
+			strconv.Itoa(batch.ID),
+			batch.StartedAt.Local().Format("2006-01-02 15:04"),
+			utils.Truncate(batch.FileName, widths[2]),
+			utils.Truncate(batch.Format, widths[3]),
+			utils.Truncate(batch.AccountName, widths[4]),
+			strconv.Itoa(batch.TotalRead),
+			strconv.Itoa(batch.TotalSkipped),
+			strconv.Itoa(batch.TotalAdded),
+			status,
+		}
+		fmt.Println(utils.FormatRow(row, widths))
+	}
+}
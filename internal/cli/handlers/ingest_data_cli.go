@@ -3,21 +3,26 @@ package handlers
 import (
 	"bufio"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/classifier"
 	"github.com/HadeZForge/FortiFi/internal/transaction/importservice"
+	"github.com/HadeZForge/FortiFi/internal/types"
 )
 
 const DEFAULT_CONFIG_PATH = "./import_config.json"
 
 // IngestDataCLI handles the data ingestion command using the new generic import system
-func IngestDataCLI(db *sql.DB, reader *bufio.Reader) {
+func IngestDataCLI(db *sql.DB, reader *bufio.Reader, config *types.Config) {
 	fmt.Println("\n=== Data Ingestion ===")
-	fmt.Println("Enter file path or 'raw' to process all files in ./raw/ directory:")
+	fmt.Printf("Enter file path or 'raw' to process all files in %s directory:\n", config.RawDirectory)
 
 	input, err := utils.PromptInput(reader, "")
 	if err != nil {
@@ -25,9 +30,15 @@ func IngestDataCLI(db *sql.DB, reader *bufio.Reader) {
 		return
 	}
 
+	preview, err := utils.ConfirmAction(reader, "Preview the import first (dry run)?")
+	if err != nil {
+		utils.PrintError("reading input", err)
+		return
+	}
+
 	if strings.ToLower(input) == "raw" {
-		// Process all CSV files in ./raw/ directory
-		totalStats, err := processRawDirectory(db)
+		// Process all files in the raw directory
+		totalStats, err := processRawDirectory(db, reader, config, preview)
 		if err != nil {
 			utils.PrintError("processing raw directory", err)
 			return
@@ -42,27 +53,32 @@ func IngestDataCLI(db *sql.DB, reader *bufio.Reader) {
 		}
 	} else {
 		// Process single file
-		stats, err := processSingleFile(db, input)
+		stats, err := processSingleFile(db, reader, input, preview)
 		if err != nil {
 			utils.PrintError("processing file", err)
 			return
 		}
 
-		// Display statistics
-		if stats != nil {
-			fmt.Printf("\n=== Import Summary ===\n")
-			fmt.Printf("Transactions read: %d\n", stats.TotalRead)
-			fmt.Printf("Transactions skipped: %d\n", stats.TotalSkipped)
-			fmt.Printf("Transactions added: %d\n", stats.TotalAdded)
+		if stats == nil {
+			// The user aborted the import
+			return
 		}
+
+		// Display statistics
+		fmt.Printf("\n=== Import Summary ===\n")
+		fmt.Printf("Import batch: %d\n", stats.BatchID)
+		fmt.Printf("Transactions read: %d\n", stats.TotalRead)
+		fmt.Printf("Transactions skipped: %d\n", stats.TotalSkipped)
+		fmt.Printf("Transactions added: %d\n", stats.TotalAdded)
+		linkNewTransfers(db, config, stats.BatchID)
 	}
 
 	fmt.Println("Data ingestion completed!")
 }
 
-// processRawDirectory processes all CSV files in the ./raw/ directory
-func processRawDirectory(db *sql.DB) (*importservice.ImportStats, error) {
-	rawDir := "./raw/"
+// processRawDirectory processes all CSV, OFX/QFX, QIF and camt XML files in the raw directory
+func processRawDirectory(db *sql.DB, reader *bufio.Reader, config *types.Config, preview bool) (*importservice.ImportStats, error) {
+	rawDir := config.RawDirectory
 
 	// Check if raw directory exists
 	if !utils.FileExists(rawDir) {
@@ -75,41 +91,43 @@ func processRawDirectory(db *sql.DB) (*importservice.ImportStats, error) {
 		return nil, fmt.Errorf("failed to read raw directory: %w", err)
 	}
 
-	csvFiles := []string{}
+	importFiles := []string{}
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(strings.ToLower(file.Name()), ".csv") {
-			csvFiles = append(csvFiles, filepath.Join(rawDir, file.Name()))
+		if !file.IsDir() && isImportableFile(file.Name()) {
+			importFiles = append(importFiles, filepath.Join(rawDir, file.Name()))
 		}
 	}
 
-	if len(csvFiles) == 0 {
-		fmt.Println("No CSV files found in ./raw/ directory")
+	if len(importFiles) == 0 {
+		fmt.Printf("No CSV, OFX, QIF or XML files found in %s directory\n", rawDir)
 		return &importservice.ImportStats{}, nil
 	}
 
-	fmt.Printf("Found %d CSV files to process:\n", len(csvFiles))
-	for _, file := range csvFiles {
+	fmt.Printf("Found %d files to process:\n", len(importFiles))
+	for _, file := range importFiles {
 		fmt.Printf("  - %s\n", file)
 	}
 
 	// Initialize total statistics
 	totalStats := &importservice.ImportStats{}
 
-	// Process each CSV file using the new generic import system
-	for _, filePath := range csvFiles {
+	// Process each file using the new generic import system
+	for _, filePath := range importFiles {
 		fmt.Printf("\nProcessing: %s\n", filePath)
-		stats, err := processSingleFile(db, filePath)
+		stats, err := processSingleFile(db, reader, filePath, preview)
 		if err != nil {
 			utils.PrintError("processing file", err)
 			continue
 		}
+		if stats == nil {
+			continue
+		}
+		linkNewTransfers(db, config, stats.BatchID)
 
 		// Add to total statistics
-		if stats != nil {
-			totalStats.TotalRead += stats.TotalRead
-			totalStats.TotalSkipped += stats.TotalSkipped
-			totalStats.TotalAdded += stats.TotalAdded
-		}
+		totalStats.TotalRead += stats.TotalRead
+		totalStats.TotalSkipped += stats.TotalSkipped
+		totalStats.TotalAdded += stats.TotalAdded
 
 		fmt.Printf("Successfully processed: %s\n", filePath)
 	}
@@ -117,8 +135,10 @@ func processRawDirectory(db *sql.DB) (*importservice.ImportStats, error) {
 	return totalStats, nil
 }
 
-// processSingleFile processes a single CSV file using the generic import system
-func processSingleFile(db *sql.DB, filePath string) (*importservice.ImportStats, error) {
+// processSingleFile processes a single statement file using the generic import system.
+// With preview set, the import is first run against a rolled-back transaction and only
+// committed once the user confirms it. Nil stats mean the user aborted the import
+func processSingleFile(db *sql.DB, reader *bufio.Reader, filePath string, preview bool) (*importservice.ImportStats, error) {
 	// Check if file exists
 	if !utils.FileExists(filePath) {
 		return nil, fmt.Errorf("file does not exist: %s", filePath)
@@ -129,12 +149,187 @@ func processSingleFile(db *sql.DB, filePath string) (*importservice.ImportStats,
 		return nil, fmt.Errorf("import configuration file not found: %s. Please create this file with your import format definitions", DEFAULT_CONFIG_PATH)
 	}
 
+	importFile := func(tx database.DBTX) (*importservice.ImportStats, error) {
+		return importservice.ImportFile(tx, filePath, DEFAULT_CONFIG_PATH)
+	}
+	run := func() (*importservice.ImportStats, error) {
+		if preview {
+			return importservice.PreviewImport(db, importFile)
+		}
+		return importFile(db)
+	}
+
 	// Use the new generic import system
 	fmt.Println("Processing file using configuration-based import...")
-	stats, err := importservice.ImportCSVFile(db, filePath, DEFAULT_CONFIG_PATH)
+	stats, err := run()
+
+	// Let the user decide when several formats fit the file
+	var ambiguous *importservice.AmbiguousFormatError
+	if errors.As(err, &ambiguous) {
+		format, selectErr := selectImportFormat(reader, ambiguous)
+		if selectErr != nil {
+			return nil, selectErr
+		}
+		importFile = func(tx database.DBTX) (*importservice.ImportStats, error) {
+			return importservice.ImportCSVFileWithFormat(tx, filePath, format)
+		}
+		stats, err = run()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to import file: %w", err)
 	}
 
+	if !preview {
+		printCategorySuggestions(stats)
+		resolveDuplicatePairs(db, reader, stats.ProbableDuplicates)
+		return stats, nil
+	}
+
+	printImportPreview(stats)
+
+	confirmed, err := utils.ConfirmAction(reader, "Import these transactions?")
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		fmt.Printf("Import aborted, nothing was saved from %s\n", filePath)
+		return nil, nil
+	}
+
+	stats, err = importFile(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import file: %w", err)
+	}
+
+	printCategorySuggestions(stats)
+	resolveDuplicatePairs(db, reader, stats.ProbableDuplicates)
 	return stats, nil
 }
+
+// printCategorySuggestions lists the new transactions no rule categorized with the categories the classifier suggests
+func printCategorySuggestions(stats *importservice.ImportStats) {
+	var suggested []importservice.ImportResult
+	for _, result := range stats.Results {
+		if result.Status == importservice.StatusAdded && len(result.Suggestions) > 0 {
+			suggested = append(suggested, result)
+		}
+	}
+	if len(suggested) == 0 {
+		return
+	}
+
+	fmt.Printf("\nSuggested categories for %d Uncategorized transaction(s):\n", len(suggested))
+	for _, result := range suggested {
+		fmt.Printf("  %s  %s  %10.2f  %-40s -> %s\n", result.TransactionID[:8],
+			result.Transaction.Date.Format("2006-01-02"), result.Transaction.Amount,
+			utils.Truncate(result.Transaction.Description, 40), classifier.FormatSuggestions(result.Suggestions))
+	}
+	fmt.Println("Change them with chg, or add a rule with ade, adi or rul")
+}
+
+// printImportPreview prints the outcome of a dry-run import grouped by what would happen to each row
+func printImportPreview(stats *importservice.ImportStats) {
+	var added, duplicates, failed []importservice.ImportResult
+	for _, result := range stats.Results {
+		switch result.Status {
+		case importservice.StatusAdded:
+			added = append(added, result)
+		case importservice.StatusDuplicate:
+			duplicates = append(duplicates, result)
+		default:
+			failed = append(failed, result)
+		}
+	}
+
+	var blacklisted, parseErrors []types.SkippedRow
+	for _, row := range stats.Skipped {
+		if row.Blacklisted {
+			blacklisted = append(blacklisted, row)
+		} else {
+			parseErrors = append(parseErrors, row)
+		}
+	}
+
+	fmt.Printf("\n=== Import Preview (nothing has been saved) ===\n")
+
+	fmt.Printf("\nNew transactions (%d):\n", len(added))
+	for _, result := range added {
+		fmt.Printf("  %s  %10.2f  %-40s -> %s (%s)\n",
+			result.Transaction.Date.Format("2006-01-02"), result.Transaction.Amount,
+			result.Transaction.Description, result.Category, result.Rule)
+		if len(result.Suggestions) > 0 {
+			fmt.Printf("  %10s  %10s  suggested: %s\n", "", "", classifier.FormatSuggestions(result.Suggestions))
+		}
+	}
+
+	fmt.Printf("\nDuplicates (%d):\n", len(duplicates))
+	for _, result := range duplicates {
+		fmt.Printf("  %s  %10.2f  %-40s (already imported as %s)\n",
+			result.Transaction.Date.Format("2006-01-02"), result.Transaction.Amount,
+			result.Transaction.Description, result.ExistingID[:8])
+	}
+
+	fmt.Printf("\nProbable duplicates (%d):\n", len(stats.ProbableDuplicates))
+	for _, pair := range stats.ProbableDuplicates {
+		fmt.Printf("  %s  %10.2f  %-40s (looks like %s %s from %s)\n",
+			displayDate(pair.Duplicate.Date), pair.Duplicate.Amount, pair.Duplicate.Description,
+			pair.Existing.Id[:8], pair.Existing.Description, displayDate(pair.Existing.Date))
+	}
+
+	fmt.Printf("\nBlacklisted (%d):\n", len(blacklisted))
+	for _, row := range blacklisted {
+		fmt.Printf("  %s: %s\n", row.Row, row.Description)
+	}
+
+	fmt.Printf("\nParse errors (%d):\n", len(parseErrors))
+	for _, row := range parseErrors {
+		fmt.Printf("  %s: %s (%s)\n", row.Row, row.Reason, row.Description)
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("\nFailed (%d):\n", len(failed))
+		for _, result := range failed {
+			fmt.Printf("  %s  %10.2f  %-40s %v\n",
+				result.Transaction.Date.Format("2006-01-02"), result.Transaction.Amount,
+				result.Transaction.Description, result.Err)
+		}
+	}
+	fmt.Println()
+}
+
+// displayDate formats a stored transaction date as YYYY-MM-DD, or returns it unchanged if it can't be parsed
+func displayDate(date string) string {
+	if parsed, err := utils.ParseDate(date); err == nil {
+		return parsed.Format("2006-01-02")
+	}
+	return date
+}
+
+// isImportableFile reports whether a file has an extension the importer understands
+func isImportableFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".ofx", ".qfx", ".qif", ".xml":
+		return true
+	}
+	return false
+}
+
+// selectImportFormat asks the user which of several matching import formats to use for a file
+func selectImportFormat(reader *bufio.Reader, ambiguous *importservice.AmbiguousFormatError) (*types.ImportFormat, error) {
+	fmt.Printf("\nMore than one import format matches the columns in %s:\n", ambiguous.FileName)
+	for i, format := range ambiguous.Candidates {
+		fmt.Printf("%d. %s (account: %s)\n", i+1, format.Identifier, format.AccountName)
+	}
+
+	input, err := utils.PromptInput(reader, "Select import format number: ")
+	if err != nil {
+		return nil, err
+	}
+
+	selection, err := strconv.Atoi(input)
+	if err != nil || selection < 1 || selection > len(ambiguous.Candidates) {
+		return nil, fmt.Errorf("invalid import format selection")
+	}
+
+	return &ambiguous.Candidates[selection-1], nil
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ListRulesCLI lists the rules in the order they are checked with how many transactions each matches,
+// optionally only those whose conditions or actions contain a search term
+func ListRulesCLI(db *sql.DB, reader *bufio.Reader) {
+	search, err := utils.PromptInput(reader, "Search rules (Enter to list all): ")
+	if err != nil {
+		utils.PrintError("reading search", err)
+		return
+	}
+
+	ruleList, stats, err := loadRuleStats(db)
+	if err != nil {
+		utils.PrintError("retrieving rules", err)
+		return
+	}
+
+	var found []types.Rule
+	for _, rule := range ruleList {
+		text := strings.ToUpper(rules.Describe(rule) + " " + rules.DescribeActions(rule))
+		if strings.Contains(text, strings.ToUpper(search)) {
+			found = append(found, rule)
+		}
+	}
+
+	if len(found) == 0 {
+		fmt.Println("No rules found.")
+		return
+	}
+
+	fmt.Printf("\n=== Rules (%d) ===\n", len(found))
+	displayRules(found, stats)
+}
+
+// EditRuleCLI changes the description text or the category of a rule, previews the transactions the
+// change would move and applies it to them
+func EditRuleCLI(db *sql.DB, reader *bufio.Reader) {
+	rule, err := selectRule(db, reader)
+	if err != nil {
+		utils.PrintError("selecting rule", err)
+		return
+	}
+
+	choice, err := utils.PromptInput(reader, "(t) Change the description text or (c) change the category: ")
+	if err != nil {
+		utils.PrintError("reading choice", err)
+		return
+	}
+
+	switch strings.ToLower(choice) {
+	case "t":
+		c := &rule.Conditions
+		// A rule has at most one kind of description condition when made by ade, adi or rul
+		var text *string
+		for _, field := range []*string{&c.DescriptionExact, &c.DescriptionContains, &c.DescriptionStartsWith, &c.DescriptionRegex} {
+			if *field != "" {
+				text = field
+				break
+			}
+		}
+		if text == nil {
+			fmt.Println("This rule doesn't check the description.")
+			return
+		}
+
+		newText, err := utils.PromptInput(reader, fmt.Sprintf("New text (currently '%s'): ", *text))
+		if err != nil {
+			utils.PrintError("reading text", err)
+			return
+		}
+		if newText == "" {
+			fmt.Println("Text can't be empty.")
+			return
+		}
+		*text = newText
+	case "c":
+		categories, err := utils.GetAvailableCategories(db)
+		if err != nil {
+			utils.PrintError("retrieving categories", err)
+			return
+		}
+		if rule.Actions.CategoryID, rule.Actions.CategoryName, err = utils.SelectCategory(db, reader, categories, true); err != nil {
+			utils.PrintError("selecting category", err)
+			return
+		}
+	default:
+		fmt.Println("Invalid choice.")
+		return
+	}
+
+	if err := rules.Validate(rule); err != nil {
+		utils.PrintError("validating rule", err)
+		return
+	}
+
+	fmt.Printf("\nIf %s\nthen %s\n", rules.Describe(rule), rules.DescribeActions(rule))
+	confirmed, err := confirmRulePreview(db, reader, rule, "Save the changed rule and apply it to existing transactions?")
+	if err != nil {
+		utils.PrintError("previewing rule", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Rule left unchanged.")
+		return
+	}
+
+	if err := database.UpdateRule(db, rule); err != nil {
+		utils.PrintError("saving rule", err)
+		return
+	}
+
+	changed, err := rules.ApplyRule(db, rule.ID)
+	if err != nil {
+		utils.PrintError("applying rule", err)
+		return
+	}
+
+	fmt.Printf(" Saved rule %d and updated %d existing transaction(s)\n", rule.ID, changed)
+}
+
+// DeleteRuleCLI deletes a rule, offering to move the transactions it categorized back to Uncategorized
+func DeleteRuleCLI(db *sql.DB, reader *bufio.Reader) {
+	rule, err := selectRule(db, reader)
+	if err != nil {
+		utils.PrintError("selecting rule", err)
+		return
+	}
+
+	fmt.Printf("\nIf %s\nthen %s\n", rules.Describe(rule), rules.DescribeActions(rule))
+	confirmed, err := utils.ConfirmAction(reader, fmt.Sprintf("Delete rule %d?", rule.ID))
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Deletion cancelled.")
+		return
+	}
+
+	if err := deleteRules(db, reader, []types.Rule{rule}); err != nil {
+		utils.PrintError("deleting rule", err)
+		return
+	}
+	fmt.Printf(" Deleted rule %d\n", rule.ID)
+}
+
+// DeadRulesCLI lists the rules that match no stored transaction and categorize none, and offers to delete them.
+// Rules that ignore transactions are left out since the transactions they match are never stored
+func DeadRulesCLI(db *sql.DB, reader *bufio.Reader) {
+	ruleList, stats, err := loadRuleStats(db)
+	if err != nil {
+		utils.PrintError("retrieving rules", err)
+		return
+	}
+
+	var dead []types.Rule
+	for _, rule := range ruleList {
+		if rule.Actions.IgnoreTransaction {
+			continue
+		}
+		if stats[rule.ID].Matched == 0 && stats[rule.ID].Categorized == 0 {
+			dead = append(dead, rule)
+		}
+	}
+
+	if len(dead) == 0 {
+		fmt.Println("Every rule matches at least one transaction.")
+		return
+	}
+
+	fmt.Printf("\n=== Rules matching no transactions (%d) ===\n", len(dead))
+	displayRules(dead, stats)
+
+	confirmed, err := utils.ConfirmAction(reader, fmt.Sprintf("\nDelete these %d rule(s)?", len(dead)))
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Rules kept.")
+		return
+	}
+
+	if err := deleteRules(db, reader, dead); err != nil {
+		utils.PrintError("deleting rules", err)
+		return
+	}
+	fmt.Printf(" Deleted %d rule(s)\n", len(dead))
+}
+
+// deleteRules deletes rules in one transaction. When they still categorize transactions the user is
+// asked whether to move those back to Uncategorized
+func deleteRules(db *sql.DB, reader *bufio.Reader, ruleList []types.Rule) error {
+	categorized := make(map[int][]string)
+	total := 0
+	for _, rule := range ruleList {
+		ids, err := rules.CategorizedBy(db, rule.ID)
+		if err != nil {
+			return err
+		}
+		categorized[rule.ID] = ids
+		total += len(ids)
+	}
+
+	revert := false
+	if total > 0 {
+		prompt := fmt.Sprintf("Move the %d transaction(s) categorized by the deleted rule(s) back to Uncategorized?", total)
+		var err error
+		if revert, err = utils.ConfirmAction(reader, prompt); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, rule := range ruleList {
+		if err := database.DeleteRule(tx, rule.ID); err != nil {
+			return err
+		}
+	}
+
+	if revert {
+		uncategorizedID, err := database.GetCategoryID(tx, "Uncategorized")
+		if err != nil {
+			return err
+		}
+		for ruleID, ids := range categorized {
+			decision := types.CategoryDecision{Source: types.CategorySourceDefault, Reason: fmt.Sprintf("rule %d was deleted", ruleID)}
+			if err := database.UpdateTransactionCategories(tx, ids, uncategorizedID, decision); err != nil {
+				return err
+			}
+		}
+		fmt.Printf(" Moved %d transaction(s) to Uncategorized\n", total)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// selectRule lists every rule and asks for the ID of one
+func selectRule(db *sql.DB, reader *bufio.Reader) (types.Rule, error) {
+	ruleList, stats, err := loadRuleStats(db)
+	if err != nil {
+		return types.Rule{}, err
+	}
+	if len(ruleList) == 0 {
+		return types.Rule{}, fmt.Errorf("no rules found")
+	}
+
+	fmt.Println("\n=== Rules ===")
+	displayRules(ruleList, stats)
+
+	input, err := utils.PromptInput(reader, "\nEnter the rule ID: ")
+	if err != nil {
+		return types.Rule{}, err
+	}
+	ruleID, err := strconv.Atoi(input)
+	if err != nil {
+		return types.Rule{}, fmt.Errorf("invalid rule ID '%s'", input)
+	}
+
+	for _, rule := range ruleList {
+		if rule.ID == ruleID {
+			return rule, nil
+		}
+	}
+	return types.Rule{}, fmt.Errorf("rule %d not found", ruleID)
+}
+
+// loadRuleStats returns the rules in the order they are checked along with their match counts
+func loadRuleStats(db *sql.DB) ([]types.Rule, map[int]rules.Stats, error) {
+	ruleList, err := rules.Load(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats, err := rules.ComputeStats(db, ruleList)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ruleList, stats, nil
+}
+
+// displayRules prints rules as a table with how many transactions each matches and categorizes
+func displayRules(ruleList []types.Rule, stats map[int]rules.Stats) {
+	header := []string{"ID", "Priority", "If", "Then", "Matches", "Categorized"}
+	widths := []int{4, 8, 50, 30, 7, 11}
+	fmt.Println(utils.FormatRow(header, widths))
+	fmt.Println(strings.Repeat("-", utils.Sum(widths)+3*(len(widths)-1)))
+
+	for _, rule := range ruleList {
+		row := []string{
+			strconv.Itoa(rule.ID),
+			strconv.Itoa(rule.Priority),
+			utils.Truncate(rules.Describe(rule), widths[2]),
+			utils.Truncate(rules.DescribeActions(rule), widths[3]),
+			strconv.Itoa(stats[rule.ID].Matched),
+			strconv.Itoa(stats[rule.ID].Categorized),
+		}
+		fmt.Println(utils.FormatRow(row, widths))
+	}
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/payees"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// PayeesCLI lists payees and manages how descriptions are turned into them: renaming and merging payees,
+// their aliases, and the regular expression rewrites applied to raw descriptions
+func PayeesCLI(db *sql.DB, reader *bufio.Reader) {
+	choice, err := utils.PromptInput(reader, "(l) list payees, (r) rename, (m) merge, (a) add alias, (x) remove alias, (w) add rewrite, (d) delete rewrite, (c) clean up unused payees: ")
+	if err != nil {
+		utils.PrintError("reading choice", err)
+		return
+	}
+
+	switch strings.ToLower(choice) {
+	case "l":
+		listPayees(db, reader)
+	case "r":
+		renamePayee(db, reader)
+	case "m":
+		mergePayees(db, reader)
+	case "a":
+		addPayeeAlias(db, reader)
+	case "x":
+		removePayeeAlias(db, reader)
+	case "w":
+		addPayeeRewrite(db, reader)
+	case "d":
+		deletePayeeRewrite(db, reader)
+	case "c":
+		cleanUpPayees(db, reader)
+	default:
+		fmt.Printf("Unknown choice '%s'\n", choice)
+	}
+}
+
+// listPayees prints the payees whose name contains the search text with their aliases, then the rewrites
+func listPayees(db *sql.DB, reader *bufio.Reader) {
+	search, err := utils.PromptInput(reader, "Search payees (Enter for all): ")
+	if err != nil {
+		utils.PrintError("reading search", err)
+		return
+	}
+
+	all, err := database.GetPayees(db)
+	if err != nil {
+		utils.PrintError("retrieving payees", err)
+		return
+	}
+	matching := filterPayees(all, search)
+	if len(matching) == 0 {
+		fmt.Println("No payees found.")
+	} else {
+		header := []string{"Payee", "Transactions", "Aliases"}
+		widths := []int{30, 12, 50}
+		fmt.Println(utils.FormatRow(header, widths))
+		fmt.Println(strings.Repeat("-", utils.Sum(widths)+3*(len(widths)-1)))
+		for _, payee := range matching {
+			row := []string{utils.Truncate(payee.Name, widths[0]), strconv.Itoa(payee.Transactions),
+				utils.Truncate(formatAliases(payee.Aliases), widths[2])}
+			fmt.Println(utils.FormatRow(row, widths))
+		}
+		fmt.Println("Aliases marked * also match descriptions that start with them")
+	}
+
+	rewrites, err := database.GetPayeeRewrites(db)
+	if err != nil {
+		utils.PrintError("retrieving rewrites", err)
+		return
+	}
+	if len(rewrites) > 0 {
+		fmt.Println("\nRewrites, applied in this order:")
+		for _, rewrite := range rewrites {
+			fmt.Printf("  %d. /%s/ -> '%s'\n", rewrite.ID, rewrite.Pattern, rewrite.Replacement)
+		}
+	}
+}
+
+// renamePayee changes the name a payee is shown with
+func renamePayee(db *sql.DB, reader *bufio.Reader) {
+	payee, err := selectPayee(db, reader, "Payee to rename")
+	if err != nil {
+		utils.PrintError("selecting payee", err)
+		return
+	}
+
+	name, err := utils.PromptInput(reader, "New name: ")
+	if err != nil {
+		utils.PrintError("reading name", err)
+		return
+	}
+	if err := database.RenamePayee(db, payee.ID, name); err != nil {
+		utils.PrintError("renaming payee", err)
+		return
+	}
+	fmt.Printf(" Renamed '%s' to '%s'\n", payee.Name, strings.TrimSpace(name))
+}
+
+// mergePayees folds one payee into another, which takes over its aliases, transactions and rules
+func mergePayees(db *sql.DB, reader *bufio.Reader) {
+	from, err := selectPayee(db, reader, "Payee to merge away")
+	if err != nil {
+		utils.PrintError("selecting payee", err)
+		return
+	}
+	into, err := selectPayee(db, reader, "Payee to keep")
+	if err != nil {
+		utils.PrintError("selecting payee", err)
+		return
+	}
+	if from.ID == into.ID {
+		fmt.Println("Pick two different payees.")
+		return
+	}
+
+	confirmed, err := utils.ConfirmAction(reader, fmt.Sprintf("Merge '%s' (%d transactions) into '%s'?", from.Name, from.Transactions, into.Name))
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Merge cancelled.")
+		return
+	}
+
+	if err := database.MergePayees(db, from.ID, into.ID); err != nil {
+		utils.PrintError("merging payees", err)
+		return
+	}
+	fmt.Printf(" Merged '%s' into '%s'\n", from.Name, into.Name)
+}
+
+// addPayeeAlias adds an alias to a payee. Descriptions that clean to the alias or start with its words
+// belong to the payee from then on
+func addPayeeAlias(db *sql.DB, reader *bufio.Reader) {
+	payee, err := selectPayee(db, reader, "Payee to add an alias to")
+	if err != nil {
+		utils.PrintError("selecting payee", err)
+		return
+	}
+
+	input, err := utils.PromptInput(reader, "Alias (e.g. BLUE BOTTLE): ")
+	if err != nil {
+		utils.PrintError("reading alias", err)
+		return
+	}
+	alias := payees.CleanAlias(input)
+	if alias == "" {
+		fmt.Println("The alias has no words left once store numbers and locations are removed.")
+		return
+	}
+
+	if err := database.SetPayeeAlias(db, types.PayeeAlias{Alias: alias, PayeeID: payee.ID, Prefix: true}); err != nil {
+		utils.PrintError("saving alias", err)
+		return
+	}
+	fmt.Printf(" Descriptions starting with '%s' now belong to '%s'\n", alias, payee.Name)
+	resolvePayees(db)
+}
+
+// removePayeeAlias removes one of a payee's aliases
+func removePayeeAlias(db *sql.DB, reader *bufio.Reader) {
+	payee, err := selectPayee(db, reader, "Payee to remove an alias from")
+	if err != nil {
+		utils.PrintError("selecting payee", err)
+		return
+	}
+	if len(payee.Aliases) == 0 {
+		fmt.Println("The payee has no aliases.")
+		return
+	}
+
+	for i, alias := range payee.Aliases {
+		fmt.Printf("%d. %s\n", i+1, formatAliases([]types.PayeeAlias{alias}))
+	}
+	input, err := utils.PromptInput(reader, "Alias number to remove: ")
+	if err != nil {
+		utils.PrintError("reading alias number", err)
+		return
+	}
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(payee.Aliases) {
+		fmt.Println("Invalid alias number")
+		return
+	}
+
+	if err := database.DeletePayeeAlias(db, payee.Aliases[number-1].Alias); err != nil {
+		utils.PrintError("removing alias", err)
+		return
+	}
+	fmt.Printf(" Removed alias '%s'\n", payee.Aliases[number-1].Alias)
+	resolvePayees(db)
+}
+
+// addPayeeRewrite stores a regular expression rewrite applied to raw descriptions before they are cleaned
+func addPayeeRewrite(db *sql.DB, reader *bufio.Reader) {
+	var rewrite types.PayeeRewrite
+	var err error
+	if rewrite.Pattern, err = utils.PromptInput(reader, "Regular expression (e.g. ^AMZN MKTP): "); err != nil {
+		utils.PrintError("reading pattern", err)
+		return
+	}
+	if rewrite.Replacement, err = utils.PromptInput(reader, "Replace with (Enter to remove the match): "); err != nil {
+		utils.PrintError("reading replacement", err)
+		return
+	}
+	if err := payees.ValidateRewrite(rewrite); err != nil {
+		utils.PrintError("validating rewrite", err)
+		return
+	}
+
+	if _, err := database.InsertPayeeRewrite(db, rewrite); err != nil {
+		utils.PrintError("saving rewrite", err)
+		return
+	}
+	fmt.Println(" Saved rewrite")
+	resolvePayees(db)
+}
+
+// deletePayeeRewrite removes a stored rewrite
+func deletePayeeRewrite(db *sql.DB, reader *bufio.Reader) {
+	rewrites, err := database.GetPayeeRewrites(db)
+	if err != nil {
+		utils.PrintError("retrieving rewrites", err)
+		return
+	}
+	if len(rewrites) == 0 {
+		fmt.Println("No rewrites found.")
+		return
+	}
+
+	for i, rewrite := range rewrites {
+		fmt.Printf("%d. /%s/ -> '%s'\n", i+1, rewrite.Pattern, rewrite.Replacement)
+	}
+	input, err := utils.PromptInput(reader, "Rewrite number to delete: ")
+	if err != nil {
+		utils.PrintError("reading rewrite number", err)
+		return
+	}
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(rewrites) {
+		fmt.Println("Invalid rewrite number")
+		return
+	}
+
+	if err := database.DeletePayeeRewrite(db, rewrites[number-1].ID); err != nil {
+		utils.PrintError("deleting rewrite", err)
+		return
+	}
+	fmt.Println(" Deleted rewrite")
+	resolvePayees(db)
+}
+
+// cleanUpPayees deletes the payees no transaction or rule refers to once confirmed. Deleting transactions
+// leaves their payees and aliases in place so alias mappings are only dropped here
+func cleanUpPayees(db *sql.DB, reader *bufio.Reader) {
+	fmt.Println("Payees with aliases you added are kept.")
+	confirmed, err := utils.ConfirmAction(reader, "Delete every payee without transactions or rules, along with its aliases?")
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("Clean up cancelled.")
+		return
+	}
+
+	deleted, err := database.DeleteUnusedPayees(db)
+	if err != nil {
+		utils.PrintError("deleting unused payees", err)
+		return
+	}
+	fmt.Printf(" Deleted %d unused payee(s)\n", deleted)
+}
+
+// resolvePayees works out every transaction's payee again after aliases or rewrites changed
+func resolvePayees(db *sql.DB) {
+	changed, err := payees.ResolveAll(db)
+	if err != nil {
+		utils.PrintError("updating payees", err)
+		return
+	}
+	fmt.Printf(" Updated the payee of %d transaction(s)\n", changed)
+}
+
+// selectPayee asks for part of a payee's name and lets the user pick among the payees that match
+func selectPayee(db *sql.DB, reader *bufio.Reader, prompt string) (types.Payee, error) {
+	search, err := utils.PromptInput(reader, prompt+" (name or part of it): ")
+	if err != nil {
+		return types.Payee{}, err
+	}
+
+	all, err := database.GetPayees(db)
+	if err != nil {
+		return types.Payee{}, err
+	}
+	matching := filterPayees(all, search)
+
+	switch {
+	case len(matching) == 0:
+		return types.Payee{}, fmt.Errorf("no payee matches '%s'", search)
+	case len(matching) == 1:
+		fmt.Printf("Selected '%s'\n", matching[0].Name)
+		return matching[0], nil
+	}
+
+	for _, payee := range matching {
+		if strings.EqualFold(payee.Name, strings.TrimSpace(search)) {
+			return payee, nil
+		}
+	}
+	for i, payee := range matching {
+		fmt.Printf("%d. %s (%d transactions)\n", i+1, payee.Name, payee.Transactions)
+	}
+	input, err := utils.PromptInput(reader, "Payee number: ")
+	if err != nil {
+		return types.Payee{}, err
+	}
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(matching) {
+		return types.Payee{}, fmt.Errorf("invalid payee number '%s'", input)
+	}
+	return matching[number-1], nil
+}
+
+// filterPayees returns the payees whose name contains the search text, ignoring case
+func filterPayees(all []types.Payee, search string) []types.Payee {
+	search = strings.ToLower(strings.TrimSpace(search))
+	var matching []types.Payee
+	for _, payee := range all {
+		if strings.Contains(strings.ToLower(payee.Name), search) {
+			matching = append(matching, payee)
+		}
+	}
+	return matching
+}
+
+// formatAliases lists aliases, marking those that match descriptions starting with them
+func formatAliases(aliases []types.PayeeAlias) string {
+	parts := make([]string, len(aliases))
+	for i, alias := range aliases {
+		parts[i] = alias.Alias
+		if alias.Prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
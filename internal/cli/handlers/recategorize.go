@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// RecategorizeCLI runs every rule again over the stored transactions in a chosen scope, shows how the
+// categories would change and applies the changes once confirmed
+func RecategorizeCLI(db *sql.DB, reader *bufio.Reader) {
+	scope, err := promptScope(db, reader)
+	if err != nil {
+		utils.PrintError("reading scope", err)
+		return
+	}
+
+	plan, err := rules.PlanRecategorize(db, scope)
+	if err != nil {
+		utils.PrintError("recategorizing transactions", err)
+		return
+	}
+
+	if plan.KeptManual > 0 {
+		fmt.Printf("Keeping %d transaction(s) categorized by hand\n", plan.KeptManual)
+	}
+	if plan.KeptImport > 0 {
+		fmt.Printf("Keeping %d transaction(s) categorized by a special rule or the imported file\n", plan.KeptImport)
+	}
+
+	if len(plan.Changes) == 0 {
+		fmt.Println("Every transaction already has the category the rules give it.")
+		return
+	}
+
+	fmt.Printf("\n=== Category changes (%d) ===\n", len(plan.Changes))
+	displayCategoryMoves(plan.Changes)
+
+	listAll, err := utils.ConfirmAction(reader, "\nList every transaction that would change?")
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if listAll {
+		fmt.Println()
+		for _, change := range plan.Changes {
+			fmt.Printf("%s  %-30s  %s  %s -> %s\n", displayDate(change.Transaction.Date),
+				utils.Truncate(change.Transaction.Description, 30), utils.FormatAmount(change.Transaction.Amount),
+				change.FromCategory, change.CategoryName)
+		}
+	}
+
+	confirmed, err := utils.ConfirmAction(reader, fmt.Sprintf("\nApply these %d change(s)?", len(plan.Changes)))
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return
+	}
+	if !confirmed {
+		fmt.Println("No changes made.")
+		return
+	}
+
+	if err := rules.ApplyChanges(db, plan.Changes); err != nil {
+		utils.PrintError("applying changes", err)
+		return
+	}
+	fmt.Printf(" Recategorized %d transaction(s)\n", len(plan.Changes))
+}
+
+// promptScope asks which transactions to recategorize
+func promptScope(db *sql.DB, reader *bufio.Reader) (rules.Scope, error) {
+	var scope rules.Scope
+
+	choice, err := utils.PromptInput(reader, "Recategorize (a) all, (d) a date range, (c) an account or (u) Uncategorized only: ")
+	if err != nil {
+		return scope, err
+	}
+
+	switch strings.ToLower(choice) {
+	case "a":
+	case "d":
+		if scope.DateFrom, err = promptOptionalDate(reader, "First date (YYYY-MM-DD, Enter for no limit): "); err != nil {
+			return scope, err
+		}
+		if scope.DateTo, err = promptOptionalDate(reader, "Last date (YYYY-MM-DD, Enter for no limit): "); err != nil {
+			return scope, err
+		}
+	case "c":
+		accounts, err := utils.GetAvailableAccounts(db)
+		if err != nil {
+			return scope, err
+		}
+		if scope.AccountID, _, err = utils.SelectAccount(reader, accounts); err != nil {
+			return scope, err
+		}
+	case "u":
+		scope.UncategorizedOnly = true
+	default:
+		return scope, fmt.Errorf("unknown scope '%s'", choice)
+	}
+
+	return scope, nil
+}
+
+// displayCategoryMoves prints how many transactions move between each pair of categories, largest first
+func displayCategoryMoves(changes []rules.Change) {
+	type move struct{ from, to string }
+	counts := make(map[move]int)
+	for _, change := range changes {
+		counts[move{change.FromCategory, change.CategoryName}]++
+	}
+
+	moves := make([]move, 0, len(counts))
+	for m := range counts {
+		moves = append(moves, m)
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		if counts[moves[i]] != counts[moves[j]] {
+			return counts[moves[i]] > counts[moves[j]]
+		}
+		if moves[i].from != moves[j].from {
+			return moves[i].from < moves[j].from
+		}
+		return moves[i].to < moves[j].to
+	})
+
+	header := []string{"From", "To", "Transactions"}
+	widths := []int{25, 25, 12}
+	fmt.Println(utils.FormatRow(header, widths))
+	fmt.Println(strings.Repeat("-", utils.Sum(widths)+3*(len(widths)-1)))
+	for _, m := range moves {
+		row := []string{utils.Truncate(m.from, widths[0]), utils.Truncate(m.to, widths[1]), strconv.Itoa(counts[m])}
+		fmt.Println(utils.FormatRow(row, widths))
+	}
+}
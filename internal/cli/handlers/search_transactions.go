@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// searchResultLimit caps how many matching transactions are listed
+const searchResultLimit = 100
+
+// SearchTransactionsCLI finds transactions whose description, payee or metadata contains the search text.
+// Text written as field:value only searches that metadata field
+func SearchTransactionsCLI(db *sql.DB, reader *bufio.Reader) {
+	input, err := utils.PromptInput(reader, "Enter search text, matching descriptions, payees and metadata (or field:value to search one metadata field): ")
+	if err != nil {
+		utils.PrintError("reading search text", err)
+		return
+	}
+	if input == "" {
+		fmt.Println("Search text cannot be empty.")
+		return
+	}
+
+	query := `
+		SELECT t.id, t.transaction_date, t.amount, t.description, t.category_id
+		FROM transactions t
+		LEFT JOIN payees p ON p.id = t.payee_id
+		WHERE t.description LIKE ? OR t.raw_description LIKE ? OR p.name LIKE ?
+		   OR EXISTS (SELECT 1 FROM transaction_metadata m WHERE m.transaction_id = t.id AND m.value LIKE ?)
+		ORDER BY t.transaction_date DESC
+		LIMIT ?
+	`
+	pattern := "%" + input + "%"
+	args := []any{pattern, pattern, pattern, pattern, searchResultLimit + 1}
+
+	if field, value, ok := strings.Cut(input, ":"); ok && field != "" && !strings.Contains(field, " ") {
+		query = `
+			SELECT t.id, t.transaction_date, t.amount, t.description, t.category_id
+			FROM transactions t
+			JOIN transaction_metadata m ON m.transaction_id = t.id
+			WHERE m.field = ? AND m.value LIKE ?
+			ORDER BY t.transaction_date DESC
+			LIMIT ?
+		`
+		args = []any{field, "%" + strings.TrimSpace(value) + "%", searchResultLimit + 1}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		utils.PrintError("searching transactions", err)
+		return
+	}
+	defer rows.Close()
+
+	var transactions []types.TableTransaction
+	for rows.Next() {
+		var t types.TableTransaction
+		if err := rows.Scan(&t.Id, &t.Date, &t.Amount, &t.Description, &t.CategoryID); err != nil {
+			utils.PrintError("reading transaction", err)
+			return
+		}
+		transactions = append(transactions, t)
+	}
+
+	if len(transactions) == 0 {
+		fmt.Printf("No transactions found matching '%s'\n", input)
+		return
+	}
+
+	truncated := len(transactions) > searchResultLimit
+	if truncated {
+		transactions = transactions[:searchResultLimit]
+	}
+
+	fmt.Printf("\nFound %d transaction(s) matching '%s':\n\n", len(transactions), input)
+	if err := utils.PrintTransactionTable(db, transactions, false); err != nil {
+		utils.PrintError("displaying transactions", err)
+		return
+	}
+
+	if truncated {
+		fmt.Printf("Showing the %d most recent matches, refine the search to see others\n", searchResultLimit)
+	}
+}
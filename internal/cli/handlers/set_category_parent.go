@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SetCategoryParentCLI places a category under a parent category, or moves it back to the top level.
+// Reports can then roll the category up into its parent, and budgets on the parent include it
+func SetCategoryParentCLI(db *sql.DB, reader *bufio.Reader) {
+	categories, err := utils.GetAvailableCategories(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+	if len(categories) < 2 {
+		fmt.Println("At least two categories are needed to nest one under another.")
+		return
+	}
+
+	tree, err := utils.LoadCategoryTree(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+	if tree.Nested() {
+		fmt.Println("Current hierarchy:")
+		tree.Print()
+		fmt.Println()
+	}
+
+	fmt.Println("Select category to move:")
+	categoryID, categoryName, err := utils.SelectCategory(db, reader, categories, false)
+	if err != nil {
+		utils.PrintError("selecting category", err)
+		return
+	}
+
+	choice, err := utils.PromptInput(reader, "(p) put it under a parent or (t) move it to the top level: ")
+	if err != nil {
+		utils.PrintError("reading choice", err)
+		return
+	}
+
+	switch strings.ToLower(choice) {
+	case "t":
+		if err := database.SetCategoryParent(db, categoryID, 0); err != nil {
+			utils.PrintError("moving category", err)
+			return
+		}
+		fmt.Printf(" '%s' is now a top-level category\n", categoryName)
+	case "p":
+		// A category cannot go under itself or one of its own subcategories
+		excluded := append(tree.Descendants(categoryID), categoryID)
+		candidates := slices.DeleteFunc(categories, func(c types.CategoryInfo) bool { return slices.Contains(excluded, c.Id) })
+		if len(candidates) == 0 {
+			fmt.Println("No other category can be its parent.")
+			return
+		}
+
+		fmt.Println("Select parent category:")
+		parentID, _, err := utils.SelectCategory(db, reader, candidates, false)
+		if err != nil {
+			utils.PrintError("selecting parent category", err)
+			return
+		}
+		if err := database.SetCategoryParent(db, categoryID, parentID); err != nil {
+			utils.PrintError("moving category", err)
+			return
+		}
+		tree, err = utils.LoadCategoryTree(db)
+		if err != nil {
+			utils.PrintError("retrieving categories", err)
+			return
+		}
+		fmt.Printf(" Moved '%s' to '%s'\n", categoryName, tree.Path(categoryID))
+	default:
+		fmt.Printf("Unknown choice '%s'\n", choice)
+	}
+}
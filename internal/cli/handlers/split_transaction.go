@@ -29,9 +29,9 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	rows, err := db.Query(`
 		SELECT t.id, t.transaction_date, t.amount, t.description, t.category_id, t.account_id
 		FROM transactions t
-		WHERE t.id LIKE ? || '%'
+		WHERE t.id LIKE ? || '%' OR t.import_fingerprint LIKE ? || '%'
 		ORDER BY t.transaction_date DESC
-	`, shortIDInput)
+	`, shortIDInput, shortIDInput)
 	if err != nil {
 		utils.PrintError("retrieving transactions", err)
 		return
@@ -93,6 +93,13 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 		}
 	}
 
+	splitTransaction(db, reader, selectedTxn)
+}
+
+// splitTransaction asks how much to split off a transaction and which category the split part goes to,
+// then inserts the split part and takes its amount off the original. Returns the split part's ID, or ""
+// when nothing was split
+func splitTransaction(db *sql.DB, reader *bufio.Reader, selectedTxn types.TableTransaction) string {
 	// Display the transaction amount
 	fmt.Printf("Transaction amount: %s\n", utils.FormatAmount(selectedTxn.Amount))
 
@@ -100,19 +107,19 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	splitAmountInput, err := utils.PromptInput(reader, fmt.Sprintf("Enter amount to split off (e.g., %s): ", utils.FormatAmount(selectedTxn.Amount/2)))
 	if err != nil {
 		utils.PrintError("reading split amount", err)
-		return
+		return ""
 	}
 
 	splitAmount, err := strconv.ParseFloat(splitAmountInput, 64)
 	if err != nil {
 		fmt.Println("Error: Please enter a valid number")
-		return
+		return ""
 	}
 
 	// Validate split amount
 	if splitAmount == 0 {
 		fmt.Println("Error: Split amount cannot be zero")
-		return
+		return ""
 	}
 
 	// Force the split amount to match the sign of the original transaction
@@ -124,7 +131,7 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	if abs(splitAmount) >= abs(selectedTxn.Amount) {
 		utils.PrintError("invalid split amount", fmt.Errorf("split amount (%s) must be less than the original transaction amount (%s)",
 			utils.FormatAmount(splitAmount), utils.FormatAmount(selectedTxn.Amount)))
-		return
+		return ""
 	}
 
 	// Calculate remaining amount
@@ -134,12 +141,12 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	categories, err := utils.GetAvailableCategories(db)
 	if err != nil {
 		utils.PrintError("retrieving categories", err)
-		return
+		return ""
 	}
 
 	if len(categories) == 0 {
 		fmt.Println("No categories found.")
-		return
+		return ""
 	}
 
 	// Prompt for category of the new transaction
@@ -147,14 +154,14 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	selectedCategoryID, selectedCategoryName, err := utils.SelectCategory(db, reader, categories, true)
 	if err != nil {
 		utils.PrintError("selecting category", err)
-		return
+		return ""
 	}
 
 	// Prompt for optional note to append to description
 	noteInput, err := utils.PromptInput(reader, "Enter optional note to append to description (or press Enter to skip): ")
 	if err != nil {
 		utils.PrintError("reading note", err)
-		return
+		return ""
 	}
 
 	// Create the description for the split transaction
@@ -173,30 +180,31 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	confirmInput, err := utils.PromptInput(reader, "\nAre you sure you want to proceed with this split? (yes/no): ")
 	if err != nil {
 		utils.PrintError("reading confirmation", err)
-		return
+		return ""
 	}
 	confirmInput = strings.ToLower(confirmInput)
 
 	if confirmInput != "yes" && confirmInput != "y" {
 		fmt.Println("Transaction split cancelled.")
-		return
+		return ""
 	}
 
 	// Parse the transaction date
 	transactionDate, err := utils.ParseDate(selectedTxn.Date)
 	if err != nil {
 		utils.PrintError("parsing transaction date", err)
-		return
+		return ""
 	}
 
 	// Generate transaction ID for the split transaction
-	splitTransactionID := txnUtils.GenerateTransactionHash(transactionDate, splitAmount, splitDescription, 0)
+	splitFingerprint := txnUtils.GenerateTransactionHash(transactionDate, splitAmount, splitDescription, 0)
+	splitTransactionID := txnUtils.GenerateTransactionID(selectedTxn.AccountID, splitFingerprint)
 
 	// Begin transaction
 	tx, err := db.Begin()
 	if err != nil {
 		utils.PrintError("beginning database transaction", err)
-		return
+		return ""
 	}
 	defer func() {
 		if err != nil {
@@ -204,14 +212,18 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 		}
 	}()
 
-	// Insert the new split transaction
+	// Insert the new split transaction, keeping the original's raw description, payee and import batch so
+	// undoing the import removes both parts, and remembering which transaction it was split from
 	_, err = tx.Exec(`
-		INSERT INTO transactions (id, account_id, category_id, amount, transaction_date, description)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, splitTransactionID, selectedTxn.AccountID, selectedCategoryID, splitAmount, selectedTxn.Date, splitDescription)
+		INSERT INTO transactions (id, account_id, category_id, amount, transaction_date, description, import_fingerprint,
+			category_source, category_reason, category_decided_at, raw_description, payee_id, import_batch_id, split_from)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, raw_description, payee_id, import_batch_id, id
+		FROM transactions WHERE id = ?
+	`, splitTransactionID, selectedTxn.AccountID, selectedCategoryID, splitAmount, selectedTxn.Date, splitDescription, splitFingerprint,
+		types.CategorySourceManual, "split from "+selectedTxn.Id[:8], selectedTxn.Id)
 	if err != nil {
 		utils.PrintError("inserting split transaction", err)
-		return
+		return ""
 	}
 
 	// Update the original transaction amount
@@ -222,18 +234,19 @@ func SplitTransactionCLI(db *sql.DB, reader *bufio.Reader) {
 	`, remainingAmount, selectedTxn.Id)
 	if err != nil {
 		utils.PrintError("updating original transaction", err)
-		return
+		return ""
 	}
 
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
 		utils.PrintError("committing transaction", err)
-		return
+		return ""
 	}
 
 	fmt.Printf("\nTransaction split successfully!\n")
 	fmt.Printf("  Original transaction updated: %s - %s\n", utils.FormatAmount(remainingAmount), utils.Truncate(selectedTxn.Description, 50))
 	fmt.Printf("  New transaction created: %s - %s (%s) [ID: %s]\n", utils.FormatAmount(splitAmount), utils.Truncate(splitDescription, 50), selectedCategoryName, splitTransactionID[:8])
+	return splitTransactionID
 }
 
 func abs(v float64) float64 {
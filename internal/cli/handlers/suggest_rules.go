@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// suggestionSamples is how many different descriptions are shown for each suggestion
+const suggestionSamples = 3
+
+// SuggestRulesCLI proposes rules for the payees that show up most among Uncategorized transactions.
+// Entering a category number accepts a proposal, which is previewed and, once confirmed, saved and applied
+func SuggestRulesCLI(db *sql.DB, reader *bufio.Reader) {
+	suggestions, err := rules.Suggest(db)
+	if err != nil {
+		utils.PrintError("finding rule suggestions", err)
+		return
+	}
+
+	if len(suggestions) == 0 {
+		fmt.Println("No payees show up more than once among Uncategorized transactions.")
+		return
+	}
+
+	categories, err := utils.GetAvailableCategories(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+
+	fmt.Println("Categories:")
+	utils.PrintCategoriesInColumns(categories, 3)
+
+	accepted := 0
+	for i, suggestion := range suggestions {
+		fmt.Printf("\n=== Suggestion %d of %d: %s ===\n", i+1, len(suggestions), suggestion.Payee)
+		fmt.Printf("%d transaction(s), %s in total\n", suggestion.Count, utils.FormatAmount(suggestion.Total))
+		for _, description := range suggestion.Descriptions[:min(len(suggestion.Descriptions), suggestionSamples)] {
+			fmt.Printf("  %s\n", description)
+		}
+		if len(suggestion.Descriptions) > suggestionSamples {
+			fmt.Printf("  ... and %d more descriptions\n", len(suggestion.Descriptions)-suggestionSamples)
+		}
+		fmt.Printf("Rule: if %s\n", rules.Describe(suggestion.Rule))
+
+		input, err := utils.PromptInput(reader, "Category number to accept (Enter to skip, q to stop): ")
+		if err != nil {
+			utils.PrintError("reading category", err)
+			return
+		}
+		if strings.ToLower(input) == "q" {
+			break
+		}
+		if input == "" {
+			continue
+		}
+
+		number, err := strconv.Atoi(input)
+		if err != nil || number < 1 || number > len(categories) {
+			fmt.Println("Invalid category number, skipped.")
+			continue
+		}
+
+		rule := suggestion.Rule
+		rule.Actions.CategoryID = categories[number-1].Id
+		rule.Actions.CategoryName = categories[number-1].Name
+
+		// Accepted suggestions are checked and previewed like rules made with ade and adi
+		if rule.Conditions.DescriptionContains != "" {
+			proceed, err := confirmIncludesConflicts(db, reader, rule)
+			if err != nil {
+				utils.PrintError("checking for conflicting rules", err)
+				continue
+			}
+			if !proceed {
+				fmt.Println("Suggestion skipped.")
+				continue
+			}
+		}
+
+		saved, changed, err := saveKeywordRule(db, reader, rule)
+		if err != nil {
+			utils.PrintError("saving rule", err)
+			continue
+		}
+		if !saved {
+			fmt.Println("Suggestion skipped.")
+			continue
+		}
+
+		accepted++
+		fmt.Printf(" Saved the rule and moved %d transaction(s) to '%s'\n", changed, categories[number-1].Name)
+	}
+
+	fmt.Printf("\nAccepted %d suggestion(s)\n", accepted)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// topMerchantRows is how many payees the top merchants report lists
+const topMerchantRows = 20
+
+// TopMerchantsCLI ranks payees by how much was spent with them or how many purchases were made, over an
+// optional date range. Income and transfers between accounts are left out
+func TopMerchantsCLI(db *sql.DB, reader *bufio.Reader) {
+	from, err := promptOptionalDate(reader, "First date (YYYY-MM-DD, Enter for no limit): ")
+	if err != nil {
+		utils.PrintError("reading date", err)
+		return
+	}
+	to, err := promptOptionalDate(reader, "Last date (YYYY-MM-DD, Enter for no limit): ")
+	if err != nil {
+		utils.PrintError("reading date", err)
+		return
+	}
+	rank, err := utils.PromptInput(reader, "Rank by (s) spend or (v) visits: ")
+	if err != nil {
+		utils.PrintError("reading ranking", err)
+		return
+	}
+
+	order := "spend DESC, visits DESC"
+	switch strings.ToLower(rank) {
+	case "s", "":
+	case "v":
+		order = "visits DESC, spend DESC"
+	default:
+		fmt.Printf("Unknown ranking '%s'\n", rank)
+		return
+	}
+
+	// Transfers between accounts are not spend
+	where := "WHERE t.amount < 0 AND t.id NOT IN (SELECT transaction_id FROM transfer_transactions)"
+	var args []any
+	if from != nil {
+		where += " AND date(t.transaction_date) >= ?"
+		args = append(args, from.Format("2006-01-02"))
+	}
+	if to != nil {
+		where += " AND date(t.transaction_date) <= ?"
+		args = append(args, to.Format("2006-01-02"))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT p.name, COUNT(*) AS visits, -SUM(t.amount) AS spend, MAX(date(t.transaction_date))
+		FROM transactions t
+		JOIN payees p ON p.id = t.payee_id
+		%s
+		GROUP BY p.id, p.name
+		ORDER BY %s, p.name
+		LIMIT ?`, where, order)
+	rows, err := db.Query(query, append(args, topMerchantRows)...)
+	if err != nil {
+		utils.PrintError("retrieving merchants", err)
+		return
+	}
+	defer rows.Close()
+
+	header := []string{"Payee", "Visits", "Spend", "Average", "Last Visit"}
+	widths := []int{30, 8, 12, 12, 10}
+	printed := false
+	for rows.Next() {
+		var name, lastVisit string
+		var visits int
+		var spend float64
+		if err := rows.Scan(&name, &visits, &spend, &lastVisit); err != nil {
+			utils.PrintError("reading merchant", err)
+			return
+		}
+		if !printed {
+			fmt.Printf("\n=== Top %d Merchants ===\n", topMerchantRows)
+			fmt.Println(utils.FormatRow(header, widths))
+			fmt.Println(strings.Repeat("-", utils.Sum(widths)+3*(len(widths)-1)))
+			printed = true
+		}
+		row := []string{utils.Truncate(name, widths[0]), strconv.Itoa(visits), fmt.Sprintf("$%.2f", spend),
+			fmt.Sprintf("$%.2f", spend/float64(visits)), lastVisit}
+		fmt.Println(utils.FormatRow(row, widths))
+	}
+	if err := rows.Err(); err != nil {
+		utils.PrintError("retrieving merchants", err)
+		return
+	}
+
+	if !printed {
+		fmt.Println("No spending found in that range.")
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TransfersCLI links new transfers between accounts and lets the user confirm or break each pairing
+func TransfersCLI(db *sql.DB, reader *bufio.Reader, config *types.Config) {
+	prompt := fmt.Sprintf("Days apart the two sides of a transfer can be (default %d): ", config.TransferWindowDays)
+	input, err := utils.PromptInput(reader, prompt)
+	if err != nil {
+		utils.PrintError("reading window", err)
+		return
+	}
+
+	windowDays := config.TransferWindowDays
+	if input != "" {
+		windowDays, err = strconv.Atoi(input)
+		if err != nil || windowDays < 0 {
+			fmt.Println("Invalid number of days.")
+			return
+		}
+	}
+
+	linked, err := database.LinkTransfers(db, windowDays, 0)
+	if err != nil {
+		utils.PrintError("linking transfers", err)
+		return
+	}
+	fmt.Printf("Linked %d new transfer(s)\n", linked)
+
+	for {
+		transfers, err := database.GetTransfers(db)
+		if err != nil {
+			utils.PrintError("retrieving transfers", err)
+			return
+		}
+
+		if len(transfers) == 0 {
+			fmt.Println("No transfers found.")
+			return
+		}
+
+		fmt.Println("\n=== Transfers ===")
+		displayTransfers(transfers)
+
+		input, err := utils.PromptInput(reader, "\nEnter a transfer number to confirm or break it (Enter to finish): ")
+		if err != nil {
+			utils.PrintError("reading transfer number", err)
+			return
+		}
+		if input == "" {
+			return
+		}
+
+		selection, err := strconv.Atoi(input)
+		if err != nil || selection < 1 || selection > len(transfers) {
+			fmt.Println("Invalid transfer number.")
+			continue
+		}
+		transfer := transfers[selection-1]
+
+		action, err := utils.PromptInput(reader, "(c) Confirm or (b) Break this transfer: ")
+		if err != nil {
+			utils.PrintError("reading action", err)
+			return
+		}
+
+		switch strings.ToLower(action) {
+		case "c":
+			if err := database.SetTransferStatus(db, transfer.ID, types.TransferConfirmed); err != nil {
+				utils.PrintError("confirming transfer", err)
+				continue
+			}
+			fmt.Println(" Transfer confirmed, both transactions are left out of income and spend")
+		case "b":
+			if err := database.SetTransferStatus(db, transfer.ID, types.TransferBroken); err != nil {
+				utils.PrintError("breaking transfer", err)
+				continue
+			}
+			fmt.Println(" Transfer broken, the pair won't be suggested again")
+		default:
+			fmt.Println("Invalid action.")
+		}
+	}
+}
+
+// linkNewTransfers pairs the transactions of an import batch with the other side of a transfer between
+// accounts and reports how many were found
+func linkNewTransfers(db *sql.DB, config *types.Config, batchID int) {
+	linked, err := database.LinkTransfers(db, config.TransferWindowDays, batchID)
+	if err != nil {
+		utils.PrintWarning("linking transfers", err)
+		return
+	}
+	if linked > 0 {
+		fmt.Printf("Linked %d new transfer(s) between accounts, confirm them with the trf command\n", linked)
+	}
+}
+
+// displayTransfers prints transfers as a numbered table
+func displayTransfers(transfers []types.Transfer) {
+	header := []string{"#", "Date", "Amount", "From", "To", "Status"}
+	widths := []int{4, 10, 10, 35, 35, 10}
+	fmt.Println(utils.FormatRow(header, widths))
+	fmt.Println(strings.Repeat("-", utils.Sum(widths)+3*(len(widths)-1)))
+
+	for i, transfer := range transfers {
+		row := []string{
+			strconv.Itoa(i + 1),
+			displayDate(transfer.From.Date),
+			fmt.Sprintf("$%.2f", transfer.To.Amount),
+			utils.Truncate(transfer.FromAccount+": "+transfer.From.Description, widths[3]),
+			utils.Truncate(transfer.ToAccount+": "+transfer.To.Description, widths[4]),
+			transfer.Status,
+		}
+		fmt.Println(utils.FormatRow(row, widths))
+	}
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/classifier"
+	txnUtils "github.com/HadeZForge/FortiFi/internal/transaction/utils"
+	"github.com/HadeZForge/FortiFi/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TriageCLI walks through the Uncategorized transactions one at a time, oldest first or grouped by
+// payee, and lets each one be categorized, turned into a rule, split, skipped or deleted
+func TriageCLI(db *sql.DB, reader *bufio.Reader) {
+	queue, err := uncategorizedTransactions(db)
+	if err != nil {
+		utils.PrintError("retrieving Uncategorized transactions", err)
+		return
+	}
+	if len(queue) == 0 {
+		fmt.Println("No Uncategorized transactions.")
+		return
+	}
+
+	order, err := utils.PromptInput(reader, "Triage (o) oldest first or (g) grouped by payee: ")
+	if err != nil {
+		utils.PrintError("reading order", err)
+		return
+	}
+	switch strings.ToLower(order) {
+	case "o", "":
+	case "g":
+		groupByPayee(queue)
+	default:
+		fmt.Printf("Unknown order '%s'\n", order)
+		return
+	}
+
+	categories, err := utils.GetAvailableCategories(db)
+	if err != nil {
+		utils.PrintError("retrieving categories", err)
+		return
+	}
+
+	fmt.Println("\nKeys: 1-3 take a suggestion, c pick a category, e exact rule, i includes rule,")
+	fmt.Println("      s split, d delete, Enter skip, q quit")
+
+	model, err := classifier.Load(db)
+	if err != nil {
+		utils.PrintWarning("loading category suggestions", err)
+	}
+	triaged := 0
+	// removed holds the queued transactions that left Uncategorized, and left counts those still ahead
+	removed := make(map[string]bool)
+	left := len(queue)
+	for i := 0; i < len(queue); i++ {
+		if removed[queue[i].Id] {
+			continue
+		}
+		txn := queue[i]
+
+		// Rules and suggestions work from the description the transaction was imported with
+		original, err := database.GetOriginalDescription(db, txn.Id)
+		if err != nil {
+			utils.PrintError("retrieving transaction", err)
+			return
+		}
+		suggestions := model.Suggest(txn.AccountID, txn.Amount, original, classifier.SuggestionCount)
+
+		fmt.Printf("\n=== %d left ===\n", left)
+		if err := utils.PrintTransactionTable(db, []types.TableTransaction{txn}, false); err != nil {
+			utils.PrintError("displaying transaction", err)
+			return
+		}
+		for n, suggestion := range suggestions {
+			fmt.Printf("  %d. %s (%.0f%%)\n", n+1, suggestion.CategoryName, suggestion.Confidence*100)
+		}
+
+		key, err := utils.PromptKey(reader, "Action: ")
+		if err != nil {
+			utils.PrintError("reading action", err)
+			return
+		}
+		key = strings.ToLower(key)
+
+		stop, changed, err := triageTransaction(db, reader, model, txn, original, key, suggestions, &categories)
+		if err != nil {
+			utils.PrintError("triaging transaction", err)
+		}
+		if stop {
+			break
+		}
+		if !changed && isSkipKey(key) {
+			left--
+			continue
+		}
+
+		if changed {
+			triaged++
+			switch key {
+			case "e", "i":
+				// A saved rule can categorize transactions further down the queue too
+				dropped, err := dropCategorized(db, queue[i:], removed)
+				if err != nil {
+					utils.PrintError("retrieving Uncategorized transactions", err)
+					return
+				}
+				left -= len(dropped)
+				learnTriaged(db, model, dropped...)
+			case "s":
+				// The rest of a split is shown again with its new amount
+				if queue[i].Amount, err = transactionAmount(db, txn.Id); err != nil {
+					utils.PrintError("retrieving transaction", err)
+					return
+				}
+			default:
+				removed[txn.Id] = true
+				left--
+			}
+		}
+
+		// Show the transaction again unless it left Uncategorized, e.g. the rest of a split or after an
+		// unknown key
+		if !removed[txn.Id] {
+			i--
+		}
+	}
+
+	fmt.Printf("\nTriaged %d transaction(s)\n", triaged)
+}
+
+// isSkipKey reports whether a key skips the current transaction
+func isSkipKey(key string) bool {
+	return key == "" || strings.ToLower(key) == "n"
+}
+
+// dropCategorized marks the queued transactions that are no longer Uncategorized as removed, such as those
+// a new rule just categorized. Returns the newly removed IDs
+func dropCategorized(db *sql.DB, queue []types.TableTransaction, removed map[string]bool) ([]string, error) {
+	remaining, err := uncategorizedTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+	uncategorized := make(map[string]bool, len(remaining))
+	for _, txn := range remaining {
+		uncategorized[txn.Id] = true
+	}
+
+	var dropped []string
+	for _, txn := range queue {
+		if !removed[txn.Id] && !uncategorized[txn.Id] {
+			removed[txn.Id] = true
+			dropped = append(dropped, txn.Id)
+		}
+	}
+	return dropped, nil
+}
+
+// learnTriaged teaches the loaded suggestion model the new categories of triaged transactions
+func learnTriaged(db *sql.DB, model *classifier.Model, transactionIDs ...string) {
+	if err := model.Update(db, transactionIDs...); err != nil {
+		utils.PrintWarning("updating category suggestions", err)
+	}
+}
+
+// triageTransaction carries out one triage key for a transaction whose original description is given.
+// Returns whether to stop triaging and whether anything changed
+func triageTransaction(db *sql.DB, reader *bufio.Reader, model *classifier.Model, txn types.TableTransaction, original string, key string,
+	suggestions []types.CategorySuggestion, categories *[]types.CategoryInfo) (bool, bool, error) {
+	switch key {
+	case "q":
+		return true, false, nil
+	case "", "n":
+		return false, false, nil
+	case "1", "2", "3":
+		n, _ := strconv.Atoi(key)
+		if n > len(suggestions) {
+			fmt.Println("No such suggestion.")
+			return false, false, nil
+		}
+		return false, true, assignTriageCategory(db, model, txn, suggestions[n-1].CategoryID, suggestions[n-1].CategoryName)
+	case "c":
+		categoryID, categoryName, err := utils.SelectCategory(db, reader, *categories, true)
+		if err != nil {
+			return false, false, err
+		}
+		// The category may be new
+		if *categories, err = utils.GetAvailableCategories(db); err != nil {
+			return false, false, err
+		}
+		return false, true, assignTriageCategory(db, model, txn, categoryID, categoryName)
+	case "e", "i":
+		return false, triageRule(db, reader, original, key == "i", *categories), nil
+	case "s":
+		splitID := splitTransaction(db, reader, txn)
+		if splitID == "" {
+			return false, false, nil
+		}
+		learnTriaged(db, model, splitID)
+		return false, true, nil
+	case "d":
+		return false, deleteTriageTransaction(db, reader, txn), nil
+	default:
+		fmt.Printf("Unknown key '%s'\n", key)
+		return false, false, nil
+	}
+}
+
+// assignTriageCategory moves a transaction to a category by hand and learns it for later suggestions
+func assignTriageCategory(db *sql.DB, model *classifier.Model, txn types.TableTransaction, categoryID int, categoryName string) error {
+	decision := types.CategoryDecision{Source: types.CategorySourceManual, Reason: "assigned in triage"}
+	if err := database.SetTransactionCategory(db, txn.Id, categoryID, decision); err != nil {
+		return err
+	}
+	learnTriaged(db, model, txn.Id)
+	fmt.Printf(" Moved to '%s'\n", categoryName)
+	return nil
+}
+
+// triageRule saves an exact or includes rule built from a transaction's original description, which is
+// what rules are matched against, and applies it. Returns whether the rule was saved
+func triageRule(db *sql.DB, reader *bufio.Reader, original string, includes bool, categories []types.CategoryInfo) bool {
+	rule := types.Rule{
+		Priority:   database.ExactRulePriority,
+		Conditions: types.RuleConditions{DescriptionExact: original},
+	}
+	if includes {
+		keyword := defaultKeyword(original)
+		prompt := "Keyword to search for in descriptions: "
+		if keyword != "" {
+			prompt = fmt.Sprintf("Keyword to search for in descriptions (Enter for '%s'): ", keyword)
+		}
+		input, err := utils.PromptInput(reader, prompt)
+		if err != nil {
+			utils.PrintError("reading keyword", err)
+			return false
+		}
+		if input != "" {
+			keyword = input
+		}
+		if keyword == "" {
+			fmt.Println("No keyword given.")
+			return false
+		}
+		rule = types.Rule{
+			Priority:   database.IncludesRulePriority,
+			Conditions: types.RuleConditions{DescriptionContains: keyword},
+		}
+	}
+
+	categoryID, categoryName, err := utils.SelectCategory(db, reader, categories, false)
+	if err != nil {
+		utils.PrintError("selecting category", err)
+		return false
+	}
+	rule.Actions = types.RuleActions{CategoryID: categoryID, CategoryName: categoryName}
+
+	if includes {
+		proceed, err := confirmIncludesConflicts(db, reader, rule)
+		if err != nil {
+			utils.PrintError("checking for conflicting rules", err)
+			return false
+		}
+		if !proceed {
+			fmt.Println("Includes rule discarded.")
+			return false
+		}
+	}
+
+	saved, changed, err := saveKeywordRule(db, reader, rule)
+	if err != nil {
+		utils.PrintError("saving rule", err)
+		return false
+	}
+	if !saved {
+		fmt.Println("Rule discarded.")
+		return false
+	}
+	fmt.Printf(" Saved the rule and moved %d transaction(s) to '%s'\n", changed, categoryName)
+	return true
+}
+
+// defaultKeyword proposes an includes keyword for a description: its payee words when the description
+// contains them as written, otherwise the longest payee word it contains
+func defaultKeyword(description string) string {
+	payee := txnUtils.NormalizeDescription(description)
+	if payee != "" && strings.Contains(description, payee) {
+		return payee
+	}
+	words := strings.Fields(payee)
+	slices.SortStableFunc(words, func(a, b string) int { return len(b) - len(a) })
+	for _, word := range words {
+		if strings.Contains(description, word) {
+			return word
+		}
+	}
+	return ""
+}
+
+// deleteTriageTransaction deletes a transaction once confirmed. Returns whether it was deleted
+func deleteTriageTransaction(db *sql.DB, reader *bufio.Reader, txn types.TableTransaction) bool {
+	confirmed, err := utils.ConfirmAction(reader, "Delete this transaction?")
+	if err != nil {
+		utils.PrintError("reading confirmation", err)
+		return false
+	}
+	if !confirmed {
+		fmt.Println("Transaction deletion cancelled.")
+		return false
+	}
+
+	if _, err := db.Exec(`DELETE FROM transactions WHERE id = ?`, txn.Id); err != nil {
+		utils.PrintError("deleting transaction", err)
+		return false
+	}
+	if err := database.DeleteOrphanedTransactionData(db); err != nil {
+		utils.PrintWarning("cleaning up transaction data", err)
+	}
+	fmt.Println(" Transaction deleted")
+	return true
+}
+
+// transactionAmount returns a transaction's current amount
+func transactionAmount(db *sql.DB, id string) (float64, error) {
+	var amount float64
+	if err := db.QueryRow(`SELECT amount FROM transactions WHERE id = ?`, id).Scan(&amount); err != nil {
+		return 0, fmt.Errorf("failed to get transaction amount: %w", err)
+	}
+	return amount, nil
+}
+
+// uncategorizedTransactions returns the Uncategorized transactions, oldest first
+func uncategorizedTransactions(db *sql.DB) ([]types.TableTransaction, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.account_id, t.category_id, t.amount, t.transaction_date, COALESCE(t.description, '')
+		FROM transactions t
+		JOIN categories c ON c.id = t.category_id
+		WHERE LOWER(c.name) = 'uncategorized'
+		ORDER BY t.transaction_date, t.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Uncategorized transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []types.TableTransaction
+	for rows.Next() {
+		var t types.TableTransaction
+		if err := rows.Scan(&t.Id, &t.AccountID, &t.CategoryID, &t.Amount, &t.Date, &t.Description); err != nil {
+			return nil, fmt.Errorf("failed to read transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// groupByPayee orders transactions so those sharing a payee follow each other, largest groups first.
+// Within a group, and between groups of the same size, the oldest come first
+func groupByPayee(transactions []types.TableTransaction) {
+	counts := make(map[string]int)
+	first := make(map[string]int)
+	for i, txn := range transactions {
+		payee := txnUtils.NormalizeDescription(txn.Description)
+		if _, ok := first[payee]; !ok {
+			first[payee] = i
+		}
+		counts[payee]++
+	}
+
+	slices.SortStableFunc(transactions, func(a, b types.TableTransaction) int {
+		payeeA := txnUtils.NormalizeDescription(a.Description)
+		payeeB := txnUtils.NormalizeDescription(b.Description)
+		if counts[payeeA] != counts[payeeB] {
+			return counts[payeeB] - counts[payeeA]
+		}
+		return first[payeeA] - first[payeeB]
+	})
+}
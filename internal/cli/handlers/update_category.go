@@ -6,6 +6,9 @@ import (
 	"fmt"
 
 	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
+	"github.com/HadeZForge/FortiFi/internal/types"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -29,23 +32,23 @@ func UpdateCategoryExactCLI(db *sql.DB, reader *bufio.Reader) {
 		return
 	}
 
-	// Update transactions with exact description match
-	result, err := db.Exec(`UPDATE transactions SET category_id = ? WHERE description = ?`, categoryID, description)
+	// Store the exact rule for future imports and apply it to existing transactions
+	saved, rowsAffected, err := saveKeywordRule(db, reader, types.Rule{
+		Priority:   database.ExactRulePriority,
+		Conditions: types.RuleConditions{DescriptionExact: description},
+		Actions:    types.RuleActions{CategoryID: categoryID, CategoryName: categoryName},
+	})
 	if err != nil {
-		utils.PrintError("updating transactions", err)
+		utils.PrintError("saving exact rule", err)
+		return
+	}
+	if !saved {
+		fmt.Println("Exact rule discarded.")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
 	fmt.Printf("Updated %d transactions with description '%s' to category '%s'\n", rowsAffected, description, categoryName)
-
-	// Store the exact keyword for future imports
-	_, err = db.Exec(`INSERT OR REPLACE INTO exact_keywords (keyword, category_id) VALUES (?, ?)`, description, categoryID)
-	if err != nil {
-		utils.PrintWarning("saving exact keyword", err)
-	} else {
-		fmt.Printf("Saved exact keyword rule for future imports\n")
-	}
+	fmt.Printf("Saved exact rule for future imports\n")
 }
 
 func UpdateCategoryIncludesCLI(db *sql.DB, reader *bufio.Reader) {
@@ -68,21 +71,98 @@ func UpdateCategoryIncludesCLI(db *sql.DB, reader *bufio.Reader) {
 		return
 	}
 
-	// Update transactions containing the keyword
-	result, err := db.Exec(`UPDATE transactions SET category_id = ? WHERE description LIKE ?`, categoryID, "%"+keyword+"%")
+	rule := types.Rule{
+		Priority:   database.IncludesRulePriority,
+		Conditions: types.RuleConditions{DescriptionContains: keyword},
+		Actions:    types.RuleActions{CategoryID: categoryID, CategoryName: categoryName},
+	}
+	proceed, err := confirmIncludesConflicts(db, reader, rule)
+	if err != nil {
+		utils.PrintError("checking for conflicting rules", err)
+		return
+	}
+	if !proceed {
+		fmt.Println("Includes rule discarded.")
+		return
+	}
+
+	// Store the includes rule for future imports and apply it to existing transactions
+	saved, rowsAffected, err := saveKeywordRule(db, reader, rule)
 	if err != nil {
-		utils.PrintError("updating transactions", err)
+		utils.PrintError("saving includes rule", err)
+		return
+	}
+	if !saved {
+		fmt.Println("Includes rule discarded.")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
 	fmt.Printf("Updated %d transactions containing '%s' to category '%s'\n", rowsAffected, keyword, categoryName)
+	fmt.Printf("Saved includes rule for future imports\n")
+}
 
-	// Store the includes keyword for future imports
-	_, err = db.Exec(`INSERT OR REPLACE INTO includes_keywords (keyword, category_id) VALUES (?, ?)`, keyword, categoryID)
+// confirmIncludesConflicts lists the includes rules whose keyword overlaps the new rule's keyword but
+// set a different category, showing which of the two decides descriptions that match both, and asks
+// whether to save the new rule anyway. Returns true straight away when there are no conflicts
+func confirmIncludesConflicts(db *sql.DB, reader *bufio.Reader, rule types.Rule) (bool, error) {
+	existing, err := rules.Load(db)
 	if err != nil {
-		utils.PrintWarning("saving includes keyword", err)
-	} else {
-		fmt.Printf("Saved includes keyword rule for future imports\n")
+		return false, err
 	}
+
+	conflicts := rules.Conflicts(existing, rule)
+	if len(conflicts) == 0 {
+		return true, nil
+	}
+
+	keyword := rule.Conditions.DescriptionContains
+	fmt.Printf("\n'%s' overlaps %d rule(s) that set a different category:\n", keyword, len(conflicts))
+	for _, conflict := range conflicts {
+		winner := fmt.Sprintf("'%s' (%s)", keyword, rule.Actions.CategoryName)
+		if conflict.CheckedFirst {
+			winner = fmt.Sprintf("rule %d (%s)", conflict.Rule.ID, conflict.Rule.Actions.CategoryName)
+		}
+		fmt.Printf("  %s -> %s, priority %d: %s wins when both match\n",
+			rules.Label(conflict.Rule), conflict.Rule.Actions.CategoryName, conflict.Rule.Priority, winner)
+	}
+
+	return utils.ConfirmAction(reader, "Save the includes rule anyway?")
+}
+
+// saveKeywordRule stores a rule that sets a category for a description keyword, replacing the
+// category of an existing rule with the same conditions. The transactions it would move are previewed
+// first and it is only saved and applied once the user confirms. Returns whether the rule was saved
+// and the number of transactions updated
+func saveKeywordRule(db *sql.DB, reader *bufio.Reader, rule types.Rule) (bool, int, error) {
+	existing, err := database.GetRules(db)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// A rule with the same conditions that only sets a category is the same keyword
+	description := rules.Describe(rule)
+	for _, stored := range existing {
+		categoryOnly := stored.Actions == types.RuleActions{CategoryID: stored.Actions.CategoryID, CategoryName: stored.Actions.CategoryName}
+		if categoryOnly && rules.Describe(stored) == description {
+			rule.ID = stored.ID
+			rule.Priority = stored.Priority
+			break
+		}
+	}
+
+	confirmed, err := confirmRulePreview(db, reader, rule, "Save the rule and apply it to these transactions?")
+	if err != nil || !confirmed {
+		return false, 0, err
+	}
+
+	if rule.ID != 0 {
+		if err := database.UpdateRuleCategory(db, rule.ID, rule.Actions.CategoryID); err != nil {
+			return false, 0, err
+		}
+	} else if rule.ID, err = database.InsertRule(db, rule); err != nil {
+		return false, 0, err
+	}
+
+	changed, err := rules.ApplyRule(db, rule.ID)
+	return true, changed, err
 }
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/cli/utils"
+	"github.com/HadeZForge/FortiFi/internal/transaction/importservice"
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// watchPollInterval is how often the raw directory is checked for new files
+const watchPollInterval = 5 * time.Second
+
+// watchedFile is what a file looked like on the previous poll, used to wait until it's fully written
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// WatchRawDirectoryCLI imports files as they appear in the raw directory until the user presses Enter.
+// Imported files are moved to a dated folder in the archive directory and files that fail to import
+// are moved to the rejected directory next to a sidecar file holding the error
+func WatchRawDirectoryCLI(db *sql.DB, reader *bufio.Reader, config *types.Config) {
+	if !utils.FileExists(config.RawDirectory) {
+		utils.PrintError("watching raw directory", fmt.Errorf("raw directory does not exist: %s", config.RawDirectory))
+		return
+	}
+
+	if !utils.FileExists(DEFAULT_CONFIG_PATH) {
+		utils.PrintError("watching raw directory", fmt.Errorf("import configuration file not found: %s", DEFAULT_CONFIG_PATH))
+		return
+	}
+
+	fmt.Printf("\n=== Watching %s ===\n", config.RawDirectory)
+	fmt.Printf("Imported files are archived to %s and failed files are moved to %s\n", config.ArchiveDirectory, config.RejectedDirectory)
+	fmt.Println("Press Enter to stop watching")
+
+	stop := make(chan struct{})
+	go func() {
+		reader.ReadString('\n')
+		close(stop)
+	}()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	seen := make(map[string]watchedFile)
+	for {
+		pollRawDirectory(db, config, seen)
+
+		select {
+		case <-stop:
+			fmt.Println("Stopped watching")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollRawDirectory imports every importable file whose size and modification time haven't changed since the last poll
+func pollRawDirectory(db *sql.DB, config *types.Config, seen map[string]watchedFile) {
+	entries, err := os.ReadDir(config.RawDirectory)
+	if err != nil {
+		utils.PrintError("reading raw directory", err)
+		return
+	}
+
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !isImportableFile(entry.Name()) {
+			continue
+		}
+
+		filePath := filepath.Join(config.RawDirectory, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[filePath] = true
+
+		// Wait for one more poll if the file is new or still being written
+		current := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if previous, ok := seen[filePath]; !ok || previous != current {
+			seen[filePath] = current
+			continue
+		}
+		delete(seen, filePath)
+
+		importWatchedFile(db, config, filePath)
+	}
+
+	// Forget files that were removed before they settled
+	for filePath := range seen {
+		if !present[filePath] {
+			delete(seen, filePath)
+		}
+	}
+}
+
+// importWatchedFile imports a single file and moves it to the archive or rejected directory
+func importWatchedFile(db *sql.DB, config *types.Config, filePath string) {
+	fmt.Printf("\n[%s] Processing: %s\n", time.Now().Format("15:04:05"), filePath)
+
+	stats, err := importservice.ImportFile(db, filePath, DEFAULT_CONFIG_PATH)
+	if err != nil {
+		utils.PrintError("importing file", err)
+		rejectWatchedFile(config, filePath, err)
+		return
+	}
+
+	fmt.Printf("Import batch %d: read %d, skipped %d, added %d\n", stats.BatchID, stats.TotalRead, stats.TotalSkipped, stats.TotalAdded)
+	if len(stats.ProbableDuplicates) > 0 {
+		fmt.Printf("%d probable duplicate(s) found, review them with the dup command\n", len(stats.ProbableDuplicates))
+	}
+	linkNewTransfers(db, config, stats.BatchID)
+
+	archiveDir := filepath.Join(config.ArchiveDirectory, time.Now().Format("2006-01-02"))
+	destination, err := moveFile(filePath, archiveDir)
+	if err != nil {
+		utils.PrintError("archiving file", err)
+		return
+	}
+	fmt.Printf("Archived to %s\n", destination)
+}
+
+// rejectWatchedFile moves a file that failed to import to the rejected directory and writes the error beside it
+func rejectWatchedFile(config *types.Config, filePath string, importErr error) {
+	destination, err := moveFile(filePath, config.RejectedDirectory)
+	if err != nil {
+		utils.PrintError("moving file to rejected directory", err)
+		return
+	}
+
+	sidecar := destination + ".error.txt"
+	message := fmt.Sprintf("File: %s\nTime: %s\nError: %v\n", filepath.Base(filePath), time.Now().Format(time.RFC3339), importErr)
+	if err := os.WriteFile(sidecar, []byte(message), 0644); err != nil {
+		utils.PrintError("writing error file", err)
+	}
+	fmt.Printf("Rejected to %s\n", destination)
+}
+
+// moveFile moves a file into a directory, creating the directory if needed. An existing file
+// with the same name is kept by adding a timestamp to the new file's name
+func moveFile(filePath string, directory string) (string, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", directory, err)
+	}
+
+	name := filepath.Base(filePath)
+	destination := filepath.Join(directory, name)
+	if utils.FileExists(destination) {
+		ext := filepath.Ext(name)
+		destination = filepath.Join(directory, fmt.Sprintf("%s_%s%s", strings.TrimSuffix(name, ext), time.Now().Format("150405"), ext))
+	}
+
+	if err := os.Rename(filePath, destination); err == nil {
+		return destination, nil
+	}
+
+	// Rename fails across drives, so fall back to copying
+	if err := copyFile(filePath, destination); err != nil {
+		return "", err
+	}
+	if err := os.Remove(filePath); err != nil {
+		return "", fmt.Errorf("failed to remove %s after copying: %w", filePath, err)
+	}
+	return destination, nil
+}
+
+// copyFile copies the contents of one file to a new file
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", source, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", destination, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", source, err)
+	}
+	return out.Close()
+}
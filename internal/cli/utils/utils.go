@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -94,19 +95,17 @@ func Truncate(s string, maxLen int) string {
 }
 
 func ResolveTransactionID(db *sql.DB, shortID string) (string, error) {
-	rows, err := db.Query(`SELECT id FROM transactions WHERE id LIKE ?`, shortID+"%")
+	matches, err := matchTransactionIDs(db, `SELECT id FROM transactions WHERE id LIKE ?`, shortID)
 	if err != nil {
 		return "", err
 	}
-	defer rows.Close()
 
-	var matches []string
-	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
+	// IDs shown before transactions were re-keyed by account live on as the fingerprint
+	if len(matches) == 0 {
+		matches, err = matchTransactionIDs(db, `SELECT id FROM transactions WHERE import_fingerprint LIKE ?`, shortID)
+		if err != nil {
 			return "", err
 		}
-		matches = append(matches, id)
 	}
 
 	if len(matches) == 0 {
@@ -118,6 +117,25 @@ func ResolveTransactionID(db *sql.DB, shortID string) (string, error) {
 	return matches[0], nil
 }
 
+// matchTransactionIDs returns the IDs of transactions whose column in the query starts with shortID
+func matchTransactionIDs(db *sql.DB, query string, shortID string) ([]string, error) {
+	rows, err := db.Query(query, shortID+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		matches = append(matches, id)
+	}
+	return matches, rows.Err()
+}
+
 // SelectTransaction prompts the user to select a transaction by ID.
 // Returns the selected transaction or an error.
 func SelectTransaction(db *sql.DB, reader *bufio.Reader) (types.TableTransaction, error) {
@@ -136,14 +154,18 @@ func SelectTransaction(db *sql.DB, reader *bufio.Reader) (types.TableTransaction
 		return types.TableTransaction{}, err
 	}
 
-	// Get the transaction details
+	return GetTableTransaction(db, fullID)
+}
+
+// GetTableTransaction loads a transaction by its full ID in the form the transaction tables print
+func GetTableTransaction(db *sql.DB, fullID string) (types.TableTransaction, error) {
 	query := `
 		SELECT t.id, t.account_id, t.category_id, t.amount, t.transaction_date, t.description
 		FROM transactions t
 		WHERE t.id = ?
 	`
 	var transaction types.TableTransaction
-	err = db.QueryRow(query, fullID).Scan(
+	err := db.QueryRow(query, fullID).Scan(
 		&transaction.Id,
 		&transaction.AccountID,
 		&transaction.CategoryID,
@@ -185,6 +207,136 @@ func GetAvailableCategories(db *sql.DB) ([]types.CategoryInfo, error) {
 	return categories, nil
 }
 
+// CategoryTree knows where each category sits in the category hierarchy, so reports can roll
+// subcategories up into their parents
+type CategoryTree struct {
+	nodes    map[int]types.CategoryNode
+	children map[int][]int
+}
+
+// LoadCategoryTree reads the category hierarchy
+func LoadCategoryTree(db *sql.DB) (*CategoryTree, error) {
+	nodes, err := database.GetCategoryNodes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &CategoryTree{nodes: make(map[int]types.CategoryNode), children: make(map[int][]int)}
+	for _, node := range nodes {
+		tree.nodes[node.ID] = node
+		tree.children[node.ParentID] = append(tree.children[node.ParentID], node.ID)
+	}
+	return tree, nil
+}
+
+// Nested reports whether any category has a parent
+func (tree *CategoryTree) Nested() bool {
+	return len(tree.children[0]) < len(tree.nodes)
+}
+
+// Name returns a category's name
+func (tree *CategoryTree) Name(categoryID int) string {
+	return tree.nodes[categoryID].Name
+}
+
+// ancestors returns a category followed by its parent, grandparent and so on up to the top level
+func (tree *CategoryTree) ancestors(categoryID int) []int {
+	var chain []int
+	for id := categoryID; id != 0 && !slices.Contains(chain, id); id = tree.nodes[id].ParentID {
+		chain = append(chain, id)
+	}
+	return chain
+}
+
+// Path names a category with its parents, e.g. "Food > Groceries"
+func (tree *CategoryTree) Path(categoryID int) string {
+	chain := tree.ancestors(categoryID)
+	names := make([]string, len(chain))
+	for i, id := range chain {
+		names[len(chain)-1-i] = tree.Name(id)
+	}
+	return strings.Join(names, " > ")
+}
+
+// Rollup returns the category a category is reported under at a level of the hierarchy, where 1 is the
+// top level. Categories at or above the level are reported under themselves, and level 0 keeps every
+// category apart
+func (tree *CategoryTree) Rollup(categoryID int, level int) int {
+	chain := tree.ancestors(categoryID)
+	if level <= 0 || len(chain) <= level {
+		return categoryID
+	}
+	return chain[len(chain)-level]
+}
+
+// Descendants returns the subcategories of a category at every depth
+func (tree *CategoryTree) Descendants(categoryID int) []int {
+	var descendants []int
+	queue := slices.Clone(tree.children[categoryID])
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == categoryID || slices.Contains(descendants, id) {
+			continue
+		}
+		descendants = append(descendants, id)
+		queue = append(queue, tree.children[id]...)
+	}
+	return descendants
+}
+
+// Print shows the hierarchy with each subcategory indented under its parent
+func (tree *CategoryTree) Print() {
+	var printLevel func(parentID int, depth int)
+	printLevel = func(parentID int, depth int) {
+		for _, id := range tree.children[parentID] {
+			fmt.Printf("%s%s\n", strings.Repeat("  ", depth), tree.Name(id))
+			printLevel(id, depth+1)
+		}
+	}
+	printLevel(0, 0)
+}
+
+// PromptCategoryLevel asks how far to roll categories up in a report. Returns 0, every category on its
+// own, without asking when no category has subcategories
+func PromptCategoryLevel(reader *bufio.Reader, tree *CategoryTree) (int, error) {
+	if !tree.Nested() {
+		return 0, nil
+	}
+	input, err := PromptInput(reader, "Category level (Enter for every category, 1 for top-level categories, 2 for the level below, ...): ")
+	if err != nil || input == "" {
+		return 0, err
+	}
+	level, err := strconv.Atoi(input)
+	if err != nil || level < 0 {
+		return 0, fmt.Errorf("invalid category level '%s'", input)
+	}
+	return level, nil
+}
+
+// PromptSummaryByPayee asks whether a report sums transactions up by category or by payee
+func PromptSummaryByPayee(reader *bufio.Reader) (bool, error) {
+	input, err := PromptInput(reader, "Summarize by (c) category or (p) payee (Enter for category): ")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(input) {
+	case "", "c":
+		return false, nil
+	case "p":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown choice '%s'", input)
+}
+
+// PayeeOrNone names a transaction's payee in report summaries, grouping transactions without one
+func PayeeOrNone(payee string) string {
+	if payee == "" {
+		return "(no payee)"
+	}
+	return payee
+}
+
 var ansiRegexp = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
 func visibleLength(s string) int {
@@ -301,6 +453,7 @@ func PrintTransactionTable(db *sql.DB, transactions []types.TableTransaction, in
 
 			fmt.Printf("Date: %s | Category: %s | Description: %s | Txn ID: %s | Amount: %s\n",
 				formattedDate, categoryStr, Truncate(t.Description, 30), t.Id[:8], amountStr)
+			PrintTransactionMetadata(db, t.Id)
 
 		}
 		fmt.Println()
@@ -308,6 +461,28 @@ func PrintTransactionTable(db *sql.DB, transactions []types.TableTransaction, in
 	return nil
 }
 
+// PrintTransactionMetadata prints a transaction's metadata fields and tags indented below it, if it has any
+func PrintTransactionMetadata(db *sql.DB, transactionID string) {
+	fields, err := database.GetTransactionMetadata(db, transactionID)
+	if err != nil {
+		PrintWarning("retrieving transaction metadata", err)
+		return
+	}
+
+	for _, field := range fields {
+		fmt.Printf("    %s: %s\n", field.Field, field.Value)
+	}
+
+	tags, err := database.GetTransactionTags(db, transactionID)
+	if err != nil {
+		PrintWarning("retrieving transaction tags", err)
+		return
+	}
+	if len(tags) > 0 {
+		fmt.Printf("    tags: %s\n", strings.Join(tags, ", "))
+	}
+}
+
 func ParseDate(dateStr string) (time.Time, error) {
 	parsedDate, err := time.Parse(time.RFC3339, dateStr)
 	if err == nil {
@@ -331,6 +506,45 @@ func PromptInput(reader *bufio.Reader, prompt string) (string, error) {
 	return strings.TrimSpace(input), nil
 }
 
+// PromptKey prints a prompt and returns the next key pressed, without waiting for Enter. Enter itself is
+// returned as "". Falls back to reading a whole line where the terminal can't be switched to single keys,
+// such as on Windows or when input is piped
+func PromptKey(reader *bufio.Reader, prompt string) (string, error) {
+	saved, err := stty("-g")
+	if err != nil || runtime.GOOS == "windows" {
+		return PromptInput(reader, prompt)
+	}
+
+	fmt.Print(prompt)
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		input, err := reader.ReadString('\n')
+		return strings.TrimSpace(input), err
+	}
+	defer stty(strings.TrimSpace(saved))
+
+	key, _, err := reader.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	if key == '\n' || key == '\r' {
+		fmt.Println()
+		return "", nil
+	}
+	fmt.Println(string(key))
+	return string(key), nil
+}
+
+// stty runs stty on the terminal attached to stdin and returns its output. Fails when stdin is not a terminal
+func stty(args ...string) (string, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("input is not a terminal")
+	}
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
+
 // PrintError prints errors in a consistent format with context.
 func PrintError(context string, err error) {
 	fmt.Printf("Error %s: %v\n", context, err)
@@ -653,14 +867,21 @@ func PrintBudgetReport(db *sql.DB) {
 	}
 }
 
-// CalculateBudgetSpending calculates total spending for given categories in a specific month
+// CalculateBudgetSpending calculates total spending for given categories and their subcategories in a specific
+// month, leaving out transfers
 func CalculateBudgetSpending(db *sql.DB, categoryIDs []int, month string) (float64, error) {
 	if len(categoryIDs) == 0 {
 		return 0, nil
 	}
 	placeholders := strings.Repeat("?,", len(categoryIDs))
 	placeholders = placeholders[:len(placeholders)-1]
-	query := fmt.Sprintf(`SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE category_id IN (%s) AND strftime('%%Y-%%m', transaction_date) = ?`, placeholders)
+	query := fmt.Sprintf(`WITH RECURSIVE budget_categories(id) AS (
+	                          SELECT id FROM categories WHERE id IN (%s)
+	                          UNION
+	                          SELECT c.id FROM categories c JOIN budget_categories b ON c.parent_id = b.id)
+	                      SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE category_id IN (SELECT id FROM budget_categories)
+	                      AND strftime('%%Y-%%m', transaction_date) = ?
+	                      AND id NOT IN (SELECT transaction_id FROM transfer_transactions)`, placeholders)
 	args := make([]any, len(categoryIDs)+1)
 	for i, id := range categoryIDs {
 		args[i] = id
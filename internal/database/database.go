@@ -7,15 +7,23 @@ import (
 	"strings"
 	"time"
 
+	txnUtils "github.com/HadeZForge/FortiFi/internal/transaction/utils"
 	"github.com/HadeZForge/FortiFi/internal/types"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx so the same queries can run inside a transaction
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 // Method to create needed tables if they don't already exist. Should be the first thing called upon startup or tables are not guaranteed to exist
 func InitTables(db *sql.DB) {
 	fmt.Println("Tables initializing")
 	// Sql create table commands
-	tableCreators := [9]string{
+	tableCreators := [20]string{
 		`CREATE TABLE IF NOT EXISTS accounts (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL,
@@ -48,18 +56,35 @@ func InitTables(db *sql.DB) {
 			FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
 		);`,
 
-		`CREATE TABLE IF NOT EXISTS exact_keywords (
+		`CREATE TABLE IF NOT EXISTS rules (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			keyword TEXT UNIQUE NOT NULL,
-			category_id INTEGER NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 100,
+			description_exact TEXT,
+			description_contains TEXT,
+			description_starts_with TEXT,
+			description_regex TEXT,
+			case_insensitive INTEGER NOT NULL DEFAULT 0,
+			amount_min REAL,
+			amount_max REAL,
+			account_id INTEGER,
+			date_from DATE,
+			date_to DATE,
+			direction TEXT,
+			category_id INTEGER,
+			rewrite_description TEXT,
+			tag TEXT,
+			mark_transfer INTEGER NOT NULL DEFAULT 0,
+			ignore_transaction INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
 			FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
 		);`,
 
-		`CREATE TABLE IF NOT EXISTS includes_keywords (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			keyword TEXT UNIQUE NOT NULL,
-			category_id INTEGER NOT NULL,
-			FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+		`CREATE TABLE IF NOT EXISTS transaction_tags (
+			transaction_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (transaction_id, tag),
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
 		);`,
 
 		`CREATE TABLE IF NOT EXISTS budget_definitions (
@@ -85,6 +110,90 @@ func InitTables(db *sql.DB) {
 			budget_amount REAL NOT NULL,
 			FOREIGN KEY (budget_definition_id) REFERENCES budget_definitions(id) ON DELETE CASCADE,
 			UNIQUE (budget_definition_id, budget_month)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS import_batches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file_name TEXT NOT NULL,
+			file_checksum TEXT NOT NULL,
+			format TEXT,
+			account_name TEXT,
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP,
+			rolled_back_at TIMESTAMP,
+			total_read INTEGER NOT NULL DEFAULT 0,
+			total_skipped INTEGER NOT NULL DEFAULT 0,
+			total_added INTEGER NOT NULL DEFAULT 0
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS transaction_metadata (
+			transaction_id TEXT NOT NULL,
+			field TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (transaction_id, field),
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS transaction_aliases (
+			account_id INTEGER NOT NULL,
+			fingerprint TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			PRIMARY KEY (account_id, fingerprint),
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS dismissed_duplicates (
+			first_transaction_id TEXT NOT NULL,
+			second_transaction_id TEXT NOT NULL,
+			PRIMARY KEY (first_transaction_id, second_transaction_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			from_transaction_id TEXT NOT NULL,
+			to_transaction_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'suggested',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (from_transaction_id, to_transaction_id),
+			FOREIGN KEY (from_transaction_id) REFERENCES transactions(id) ON DELETE CASCADE,
+			FOREIGN KEY (to_transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+		);`,
+
+		// What the category classifier learned from each transaction. Kept without a foreign key so
+		// the classifier can unlearn transactions that were deleted
+		`CREATE TABLE IF NOT EXISTS classifier_examples (
+			transaction_id TEXT PRIMARY KEY,
+			category_id INTEGER NOT NULL,
+			features TEXT NOT NULL
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS classifier_counts (
+			category_id INTEGER NOT NULL,
+			feature TEXT NOT NULL,
+			count INTEGER NOT NULL,
+			PRIMARY KEY (category_id, feature)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS payees (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL COLLATE NOCASE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Cleaned descriptions that belong to a payee. Prefix aliases also match cleaned descriptions
+		// that start with their words
+		`CREATE TABLE IF NOT EXISTS payee_aliases (
+			alias TEXT PRIMARY KEY,
+			payee_id INTEGER NOT NULL,
+			prefix INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (payee_id) REFERENCES payees(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS payee_rewrites (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			pattern TEXT NOT NULL,
+			replacement TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);`}
 
 	for _, element := range tableCreators {
@@ -94,64 +203,412 @@ func InitTables(db *sql.DB) {
 		}
 	}
 
+	// Columns added after the original schema, for databases created by older versions
+	columnAdders := []struct{ table, column, definition string }{
+		{"transactions", "import_batch_id", "INTEGER REFERENCES import_batches(id)"},
+		{"transactions", "split_from", "TEXT"},
+		{"account_snapshots", "import_batch_id", "INTEGER REFERENCES import_batches(id)"},
+		{"transactions", "import_fingerprint", "TEXT"},
+		{"transactions", "is_transfer", "INTEGER NOT NULL DEFAULT 0"},
+		{"transactions", "category_source", "TEXT"},
+		{"transactions", "category_rule_id", "INTEGER"},
+		{"transactions", "category_reason", "TEXT"},
+		{"transactions", "category_decided_at", "DATETIME"},
+		{"transactions", "raw_description", "TEXT"},
+		{"transactions", "payee_id", "INTEGER REFERENCES payees(id)"},
+		{"rules", "payee_id", "INTEGER REFERENCES payees(id)"},
+		{"categories", "parent_id", "INTEGER REFERENCES categories(id)"},
+	}
+
+	for _, element := range columnAdders {
+		if err := addColumnIfMissing(db, element.table, element.column, element.definition); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_transactions_fingerprint ON transactions (account_id, import_fingerprint)`); err != nil {
+		log.Fatal(err)
+	}
+
+	// Transfers are paired by amount, duplicates by account and amount, and the transactions of an
+	// import batch are looked up together
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_transactions_amount ON transactions (amount)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account_amount ON transactions (account_id, amount)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_import_batch ON transactions (import_batch_id)`,
+	}
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Transactions that are one side of a confirmed transfer or were marked as a transfer by a rule,
+	// which reports leave out of income and spend. Suggested transfers still count until the user
+	// confirms them. Recreated so older definitions are replaced
+	transferView := `DROP VIEW IF EXISTS transfer_transactions;
+		CREATE VIEW transfer_transactions AS
+			SELECT from_transaction_id AS transaction_id FROM transfers WHERE status = 'confirmed'
+			UNION
+			SELECT to_transaction_id FROM transfers WHERE status = 'confirmed'
+			UNION
+			SELECT id FROM transactions WHERE is_transfer = 1;`
+	if _, err := db.Exec(transferView); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := migrateTransactionIdentity(db); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := migrateKeywordRules(db); err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Println("Tables initialized successfully!")
 }
 
-// / #################################
-// / Keywords
-// / #################################
-func GetExactKeywords(db *sql.DB) (map[string]int, error) {
-	query := "SELECT keyword, category_id FROM exact_keywords"
-	rows, err := db.Query(query)
+// addColumnIfMissing adds a column to an existing table unless it is already there
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		fmt.Println("GetExactKeywords failed while querying for keywords")
-		return nil, err
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
 	}
 	defer rows.Close()
 
-	keywordsMap := make(map[string]int)
 	for rows.Next() {
-		var keyword string
-		var categoryID int
-		if err := rows.Scan(&keyword, &categoryID); err != nil {
-			fmt.Println("GetExactKeywords failed while scanning rows")
-			return nil, err
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
 		}
-		keywordsMap[keyword] = categoryID
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
 	}
 
-	if err = rows.Err(); err != nil {
-		fmt.Println("GetExactKeywords failed while iterating over rows")
-		return nil, err
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s to %s: %w", column, table, err)
+	}
+	return nil
+}
+
+// migrateTransactionIdentity re-keys transactions created before IDs included the account.
+// The old ID becomes the row's dedupe fingerprint, so re-importing a file still finds the row
+// even if its amount was changed by a split, and the new ID is derived from the account and that
+// fingerprint exactly like newly imported rows. Runs once, tracked by the database's user_version
+func migrateTransactionIdentity(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version >= 1 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, account_id FROM transactions WHERE import_fingerprint IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read transactions to migrate: %w", err)
+	}
+
+	type legacyTransaction struct {
+		id        string
+		accountID int
+	}
+	var legacy []legacyTransaction
+	for rows.Next() {
+		var t legacyTransaction
+		if err := rows.Scan(&t.id, &t.accountID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read transaction to migrate: %w", err)
+		}
+		legacy = append(legacy, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read transactions to migrate: %w", err)
+	}
+
+	for _, t := range legacy {
+		newID := txnUtils.GenerateTransactionID(t.accountID, t.id)
+		if _, err := tx.Exec(`UPDATE transactions SET id = ?, import_fingerprint = ? WHERE id = ?`, newID, t.id, t.id); err != nil {
+			return fmt.Errorf("failed to re-key transaction %s: %w", t.id[:8], err)
+		}
+		if _, err := tx.Exec(`UPDATE transaction_metadata SET transaction_id = ? WHERE transaction_id = ?`, newID, t.id); err != nil {
+			return fmt.Errorf("failed to re-key metadata of transaction %s: %w", t.id[:8], err)
+		}
+	}
+
+	if _, err := tx.Exec(`PRAGMA user_version = 1`); err != nil {
+		return fmt.Errorf("failed to update schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration: %w", err)
+	}
+
+	if len(legacy) > 0 {
+		fmt.Printf("Migrated %d transactions to account-aware IDs\n", len(legacy))
+	}
+	return nil
+}
+
+// migrateKeywordRules moves the exact and includes keywords of older versions into the rules table.
+// Exact keywords get a higher priority so they still win over includes keywords like they used to.
+// Runs once, tracked by the database's user_version
+func migrateKeywordRules(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version >= 2 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	keywordTables := []struct {
+		table, column string
+		priority      int
+	}{
+		{"exact_keywords", "description_exact", ExactRulePriority},
+		{"includes_keywords", "description_contains", IncludesRulePriority},
+	}
+
+	migrated := 0
+	for _, keywords := range keywordTables {
+		var exists bool
+		query := `SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`
+		if err := tx.QueryRow(query, keywords.table).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check for %s: %w", keywords.table, err)
+		}
+		if !exists {
+			continue
+		}
+
+		query = fmt.Sprintf(`INSERT INTO rules (priority, %s, category_id) SELECT ?, keyword, category_id FROM %s ORDER BY id`, keywords.column, keywords.table)
+		result, err := tx.Exec(query, keywords.priority)
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", keywords.table, err)
+		}
+		count, _ := result.RowsAffected()
+		migrated += int(count)
+
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE %s`, keywords.table)); err != nil {
+			return fmt.Errorf("failed to drop %s: %w", keywords.table, err)
+		}
+	}
+
+	if _, err := tx.Exec(`PRAGMA user_version = 2`); err != nil {
+		return fmt.Errorf("failed to update schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration: %w", err)
+	}
+
+	if migrated > 0 {
+		fmt.Printf("Migrated %d keywords to rules\n", migrated)
+	}
+	return nil
+}
+
+// nullableID stores unset (zero) IDs as NULL
+func nullableID(id int) any {
+	if id == 0 {
+		return nil
 	}
-	return keywordsMap, nil
+	return id
 }
 
-func GetIncludesKeywords(db *sql.DB) (map[string]int, error) {
-	query := "SELECT keyword, category_id FROM includes_keywords"
+// / #################################
+// / Rules
+// / #################################
+
+// Default priorities of rules created by the ade and adi commands, so exact rules are checked before includes rules
+const (
+	ExactRulePriority    = 200
+	IncludesRulePriority = 100
+)
+
+// ruleColumns lists the rule columns in the order InsertRule, UpdateRule and GetRules use them
+const ruleColumns = `priority, description_exact, description_contains, description_starts_with, description_regex,
+	case_insensitive, amount_min, amount_max, account_id, date_from, date_to, direction,
+	category_id, rewrite_description, tag, mark_transfer, ignore_transaction, payee_id`
+
+// InsertRule stores a new rule and returns its ID
+func InsertRule(db DBTX, rule types.Rule) (int, error) {
+	query := `INSERT INTO rules (` + ruleColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, ruleValues(rule)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inserted rule ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetRules returns every rule, oldest first
+func GetRules(db DBTX) ([]types.Rule, error) {
+	query := `SELECT r.id, ` + prefixColumns("r.", ruleColumns) + `, COALESCE(a.name, ''), COALESCE(c.name, ''), COALESCE(p.name, '')
+	          FROM rules r
+	          LEFT JOIN accounts a ON a.id = r.account_id
+	          LEFT JOIN categories c ON c.id = r.category_id
+	          LEFT JOIN payees p ON p.id = r.payee_id
+	          ORDER BY r.id ASC`
 	rows, err := db.Query(query)
 	if err != nil {
-		fmt.Println("GetIncludesKeywords failed while querying for keywords")
-		return nil, err
+		return nil, fmt.Errorf("could not execute query: %w", err)
 	}
 	defer rows.Close()
 
-	keywordsMap := make(map[string]int)
+	var rules []types.Rule
 	for rows.Next() {
-		var keyword string
-		var categoryID int
-		if err := rows.Scan(&keyword, &categoryID); err != nil {
-			fmt.Println("GetIncludesKeywords failed while scanning rows")
-			return nil, err
+		var rule types.Rule
+		var exact, contains, startsWith, regex, direction, rewrite, tag sql.NullString
+		var amountMin, amountMax sql.NullFloat64
+		var accountID, categoryID, payeeID sql.NullInt64
+		var dateFrom, dateTo sql.NullTime
+		c, a := &rule.Conditions, &rule.Actions
+		err := rows.Scan(&rule.ID, &rule.Priority, &exact, &contains, &startsWith, &regex,
+			&c.CaseInsensitive, &amountMin, &amountMax, &accountID, &dateFrom, &dateTo, &direction,
+			&categoryID, &rewrite, &tag, &a.MarkTransfer, &a.IgnoreTransaction, &payeeID,
+			&c.AccountName, &a.CategoryName, &c.PayeeName)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		c.DescriptionExact = exact.String
+		c.DescriptionContains = contains.String
+		c.DescriptionStartsWith = startsWith.String
+		c.DescriptionRegex = regex.String
+		c.Direction = direction.String
+		c.AccountID = int(accountID.Int64)
+		c.PayeeID = int(payeeID.Int64)
+		if amountMin.Valid {
+			c.AmountMin = &amountMin.Float64
+		}
+		if amountMax.Valid {
+			c.AmountMax = &amountMax.Float64
+		}
+		if dateFrom.Valid {
+			c.DateFrom = &dateFrom.Time
+		}
+		if dateTo.Valid {
+			c.DateTo = &dateTo.Time
 		}
-		keywordsMap[keyword] = categoryID
+		a.CategoryID = int(categoryID.Int64)
+		a.RewriteDescription = rewrite.String
+		a.Tag = tag.String
+
+		rules = append(rules, rule)
 	}
 
-	if err = rows.Err(); err != nil {
-		fmt.Println("GetIncludesKeywords failed while iterating over rows")
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return rules, nil
+}
+
+// UpdateRule replaces the priority, conditions and actions of a stored rule
+func UpdateRule(db DBTX, rule types.Rule) error {
+	columns := strings.Split(ruleColumns, ",")
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column) + " = ?"
 	}
-	return keywordsMap, nil
+
+	query := `UPDATE rules SET ` + strings.Join(columns, ", ") + ` WHERE id = ?`
+	if _, err := db.Exec(query, append(ruleValues(rule), rule.ID)...); err != nil {
+		return fmt.Errorf("failed to update rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteRule removes a rule. Transactions it categorized keep their category
+func DeleteRule(db DBTX, ruleID int) error {
+	if _, err := db.Exec(`DELETE FROM rules WHERE id = ?`, ruleID); err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	return nil
+}
+
+// ruleValues returns the values of a rule in ruleColumns order
+func ruleValues(rule types.Rule) []any {
+	c, a := rule.Conditions, rule.Actions
+	return []any{rule.Priority,
+		nullableString(c.DescriptionExact), nullableString(c.DescriptionContains),
+		nullableString(c.DescriptionStartsWith), nullableString(c.DescriptionRegex),
+		c.CaseInsensitive, c.AmountMin, c.AmountMax, nullableID(c.AccountID),
+		nullableDate(c.DateFrom), nullableDate(c.DateTo), nullableString(c.Direction),
+		nullableID(a.CategoryID), nullableString(a.RewriteDescription), nullableString(a.Tag),
+		a.MarkTransfer, a.IgnoreTransaction, nullableID(c.PayeeID)}
+}
+
+// UpdateRuleCategory changes the category a rule sets
+func UpdateRuleCategory(db DBTX, ruleID int, categoryID int) error {
+	if _, err := db.Exec(`UPDATE rules SET category_id = ? WHERE id = ?`, categoryID, ruleID); err != nil {
+		return fmt.Errorf("failed to update rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteCategoryRules takes a category out of the rules that set it. Rules left without any action are deleted
+func DeleteCategoryRules(db DBTX, categoryID int) error {
+	if _, err := db.Exec(`UPDATE rules SET category_id = NULL WHERE category_id = ?`, categoryID); err != nil {
+		return fmt.Errorf("failed to update rules: %w", err)
+	}
+
+	query := `DELETE FROM rules
+	          WHERE category_id IS NULL AND rewrite_description IS NULL AND tag IS NULL
+	            AND mark_transfer = 0 AND ignore_transaction = 0`
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("failed to delete rules: %w", err)
+	}
+	return nil
+}
+
+// prefixColumns adds a table alias to each column in a comma separated column list
+func prefixColumns(prefix string, columns string) string {
+	fields := strings.Split(columns, ",")
+	for i, field := range fields {
+		fields[i] = prefix + strings.TrimSpace(field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// nullableString stores empty strings as NULL
+func nullableString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// nullableDate stores unset dates as NULL
+func nullableDate(date *time.Time) any {
+	if date == nil {
+		return nil
+	}
+	return *date
 }
 
 /// #################################
@@ -159,7 +616,7 @@ func GetIncludesKeywords(db *sql.DB) (map[string]int, error) {
 /// #################################
 
 // GetCategoryNameByID retrieves the category name by its ID
-func GetCategoryNameByID(db *sql.DB, categoryID int) (string, error) {
+func GetCategoryNameByID(db DBTX, categoryID int) (string, error) {
 	var categoryName string
 	query := "SELECT name FROM categories WHERE id = ?"
 	err := db.QueryRow(query, categoryID).Scan(&categoryName)
@@ -173,7 +630,7 @@ func GetCategoryNameByID(db *sql.DB, categoryID int) (string, error) {
 }
 
 // GetCategoryID fetches the category ID for a given category name
-func GetCategoryID(db *sql.DB, categoryName string) (int, error) {
+func GetCategoryID(db DBTX, categoryName string) (int, error) {
 	// Validate category name
 	trimmedName := strings.TrimSpace(categoryName)
 	if trimmedName == "" {
@@ -193,8 +650,22 @@ func GetCategoryID(db *sql.DB, categoryName string) (int, error) {
 	return categoryID, nil
 }
 
+// FindCategoryID returns the ID of the category with a name, or 0 when there is none. Unlike GetCategoryID
+// it never creates the category
+func FindCategoryID(db DBTX, categoryName string) (int, error) {
+	var categoryID int
+	err := db.QueryRow(`SELECT id FROM categories WHERE name = ?`, strings.TrimSpace(categoryName)).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find category: %w", err)
+	}
+	return categoryID, nil
+}
+
 // InsertCategory inserts a new category and returns the inserted ID
-func InsertCategory(db *sql.DB, categoryName string) (int, error) {
+func InsertCategory(db DBTX, categoryName string) (int, error) {
 	// Validate category name
 	trimmedName := strings.TrimSpace(categoryName)
 	if trimmedName == "" {
@@ -216,12 +687,48 @@ func InsertCategory(db *sql.DB, categoryName string) (int, error) {
 	return int(categoryID), nil
 }
 
+// GetCategoryNodes returns every category with the category it belongs under, by name
+func GetCategoryNodes(db DBTX) ([]types.CategoryNode, error) {
+	rows, err := db.Query(`SELECT id, name, COALESCE(parent_id, 0) FROM categories ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []types.CategoryNode
+	for rows.Next() {
+		var node types.CategoryNode
+		if err := rows.Scan(&node.ID, &node.Name, &node.ParentID); err != nil {
+			return nil, fmt.Errorf("failed to read category: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+// SetCategoryParent places a category under another one, or at the top level when parentID is 0
+func SetCategoryParent(db DBTX, categoryID int, parentID int) error {
+	if _, err := db.Exec(`UPDATE categories SET parent_id = ? WHERE id = ?`, nullableID(parentID), categoryID); err != nil {
+		return fmt.Errorf("failed to set parent category: %w", err)
+	}
+	return nil
+}
+
+// ReparentCategoryChildren moves the subcategories of a category up to its own parent, before it is deleted
+func ReparentCategoryChildren(db DBTX, categoryID int) error {
+	query := `UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = ?) WHERE parent_id = ?`
+	if _, err := db.Exec(query, categoryID, categoryID); err != nil {
+		return fmt.Errorf("failed to move subcategories: %w", err)
+	}
+	return nil
+}
+
 /// #################################
 /// Account
 /// #################################
 
 // GetAccountID fetches the account ID for a given account name
-func GetAccountID(db *sql.DB, accountName string) (int, error) {
+func GetAccountID(db DBTX, accountName string) (int, error) {
 	// Validate account name
 	trimmedName := strings.TrimSpace(accountName)
 	if trimmedName == "" {
@@ -242,7 +749,7 @@ func GetAccountID(db *sql.DB, accountName string) (int, error) {
 }
 
 // GetAccountID fetches the account name for a given account id
-func GetAccountName(db *sql.DB, accountId int) (string, error) {
+func GetAccountName(db DBTX, accountId int) (string, error) {
 	var accountName string
 	query := "SELECT name FROM accounts WHERE id = ?"
 
@@ -255,7 +762,7 @@ func GetAccountName(db *sql.DB, accountId int) (string, error) {
 }
 
 // InsertAccount inserts a new account and returns the inserted ID
-func InsertAccount(db *sql.DB, accountName string) (int, error) {
+func InsertAccount(db DBTX, accountName string) (int, error) {
 	// Validate account name
 	trimmedName := strings.TrimSpace(accountName)
 	if trimmedName == "" {
@@ -311,8 +818,9 @@ func GetAccountHistory(db *sql.DB, accountID int) ([]types.AccountSnapshot, erro
 	return snapshots, nil
 }
 
-// InsertCategory inserts a new category and returns the inserted ID
-func InsertAccountSnapshot(db *sql.DB, accountID int, snapshotTime time.Time, newBalance float64) (int, error) {
+// InsertAccountSnapshot inserts a balance snapshot unless an identical one exists and returns its ID.
+// New snapshots are linked to the given import batch, if any
+func InsertAccountSnapshot(db DBTX, accountID int, snapshotTime time.Time, newBalance float64, batchID int) (int, error) {
 	var existingID int
 
 	// Check if a snapshot already exists with the same timestamp and balance
@@ -327,9 +835,9 @@ func InsertAccountSnapshot(db *sql.DB, accountID int, snapshotTime time.Time, ne
 	}
 
 	// Insert a new snapshot if no existing record matches
-	queryInsert := `INSERT INTO account_snapshots (account_id, snapshot_time, balance) 
-	          VALUES (?, ?, ?)`
-	result, err := db.Exec(queryInsert, accountID, snapshotTime, newBalance)
+	queryInsert := `INSERT INTO account_snapshots (account_id, snapshot_time, balance, import_batch_id) 
+	          VALUES (?, ?, ?, ?)`
+	result, err := db.Exec(queryInsert, accountID, snapshotTime, newBalance, nullableID(batchID))
 	if err != nil {
 		return 0, err
 	}
@@ -344,7 +852,7 @@ func InsertAccountSnapshot(db *sql.DB, accountID int, snapshotTime time.Time, ne
 }
 
 // TransactionExists checks if a transaction with the given ID already exists
-func TransactionExists(db *sql.DB, transactionID string) (bool, error) {
+func TransactionExists(db DBTX, transactionID string) (bool, error) {
 	var exists bool
 	query := "SELECT EXISTS(SELECT 1 FROM transactions WHERE id = ?)"
 	err := db.QueryRow(query, transactionID).Scan(&exists)
@@ -354,6 +862,785 @@ func TransactionExists(db *sql.DB, transactionID string) (bool, error) {
 	return exists, nil
 }
 
+// FindTransactionByFingerprint returns the ID of the account's transaction with the given dedupe fingerprint,
+// including fingerprints of duplicates that were merged into another transaction. Returns "" when there is none
+func FindTransactionByFingerprint(db DBTX, accountID int, fingerprint string) (string, error) {
+	var transactionID string
+	query := `SELECT id FROM transactions WHERE account_id = ? AND import_fingerprint = ?
+	          UNION ALL
+	          SELECT transaction_id FROM transaction_aliases WHERE account_id = ? AND fingerprint = ?
+	          LIMIT 1`
+	err := db.QueryRow(query, accountID, fingerprint, accountID, fingerprint).Scan(&transactionID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return transactionID, nil
+}
+
+// SetTransactionCategory moves a transaction to a category and records what decided it
+func SetTransactionCategory(db DBTX, transactionID string, categoryID int, decision types.CategoryDecision) error {
+	query := `UPDATE transactions
+	          SET category_id = ?, category_source = ?, category_rule_id = ?, category_reason = ?, category_decided_at = CURRENT_TIMESTAMP
+	          WHERE id = ?`
+	if _, err := db.Exec(query, categoryID, decision.Source, nullableID(decision.RuleID), decision.Reason, transactionID); err != nil {
+		return fmt.Errorf("failed to update transaction category: %w", err)
+	}
+	return nil
+}
+
+// UpdateTransactionCategories moves transactions to a category for the same reason
+func UpdateTransactionCategories(db DBTX, transactionIDs []string, categoryID int, decision types.CategoryDecision) error {
+	for _, id := range transactionIDs {
+		if err := SetTransactionCategory(db, id, categoryID, decision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCategoryDecision returns what assigned a transaction's category. The source is empty for
+// transactions categorized before decisions were recorded
+func GetCategoryDecision(db DBTX, transactionID string) (types.CategoryDecision, error) {
+	var decision types.CategoryDecision
+	var source, reason sql.NullString
+	var ruleID sql.NullInt64
+	var decidedAt sql.NullTime
+	query := `SELECT category_source, category_rule_id, category_reason, category_decided_at FROM transactions WHERE id = ?`
+	if err := db.QueryRow(query, transactionID).Scan(&source, &ruleID, &reason, &decidedAt); err != nil {
+		return decision, fmt.Errorf("failed to get category decision: %w", err)
+	}
+
+	decision.Source = source.String
+	decision.RuleID = int(ruleID.Int64)
+	decision.Reason = reason.String
+	decision.DecidedAt = decidedAt.Time
+	return decision, nil
+}
+
+// GetOriginalDescription returns the description a transaction was imported or added with, before any
+// rule rewrote it
+func GetOriginalDescription(db DBTX, transactionID string) (string, error) {
+	var description string
+	query := `SELECT COALESCE(raw_description, description, '') FROM transactions WHERE id = ?`
+	if err := db.QueryRow(query, transactionID).Scan(&description); err != nil {
+		return "", fmt.Errorf("failed to get original description: %w", err)
+	}
+	return description, nil
+}
+
+// InsertTransactionMetadata stores the metadata fields of a transaction, replacing existing values
+func InsertTransactionMetadata(db DBTX, transactionID string, metadata map[string]string) error {
+	for field, value := range metadata {
+		query := `INSERT OR REPLACE INTO transaction_metadata (transaction_id, field, value) VALUES (?, ?, ?)`
+		if _, err := db.Exec(query, transactionID, field, value); err != nil {
+			return fmt.Errorf("failed to insert metadata field '%s': %w", field, err)
+		}
+	}
+	return nil
+}
+
+// GetTransactionMetadata returns the metadata fields of a transaction sorted by field name
+func GetTransactionMetadata(db DBTX, transactionID string) ([]types.MetadataField, error) {
+	query := `SELECT field, value FROM transaction_metadata WHERE transaction_id = ? ORDER BY field`
+	rows, err := db.Query(query, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var fields []types.MetadataField
+	for rows.Next() {
+		var field types.MetadataField
+		if err := rows.Scan(&field.Field, &field.Value); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		fields = append(fields, field)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return fields, nil
+}
+
+// InsertTransactionTags adds tags to a transaction and returns how many it didn't already have
+func InsertTransactionTags(db DBTX, transactionID string, tags []string) (int, error) {
+	added := 0
+	for _, tag := range tags {
+		result, err := db.Exec(`INSERT OR IGNORE INTO transaction_tags (transaction_id, tag) VALUES (?, ?)`, transactionID, tag)
+		if err != nil {
+			return added, fmt.Errorf("failed to insert tag '%s': %w", tag, err)
+		}
+		if rows, _ := result.RowsAffected(); rows > 0 {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// GetTransactionTags returns the tags of a transaction in alphabetical order
+func GetTransactionTags(db DBTX, transactionID string) ([]string, error) {
+	rows, err := db.Query(`SELECT tag FROM transaction_tags WHERE transaction_id = ? ORDER BY tag`, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// DeleteOrphanedTransactionData removes metadata, tags, fingerprint aliases, dismissed duplicate
+// pairs and transfers whose transactions no longer exist. Payees are kept along with their aliases
+func DeleteOrphanedTransactionData(db DBTX) error {
+	queries := []string{
+		`DELETE FROM transaction_metadata WHERE transaction_id NOT IN (SELECT id FROM transactions)`,
+		`DELETE FROM transaction_tags WHERE transaction_id NOT IN (SELECT id FROM transactions)`,
+		`DELETE FROM transaction_aliases WHERE transaction_id NOT IN (SELECT id FROM transactions)`,
+		`DELETE FROM dismissed_duplicates
+		 WHERE first_transaction_id NOT IN (SELECT id FROM transactions)
+		    OR second_transaction_id NOT IN (SELECT id FROM transactions)`,
+		`DELETE FROM transfers
+		 WHERE from_transaction_id NOT IN (SELECT id FROM transactions)
+		    OR to_transaction_id NOT IN (SELECT id FROM transactions)`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// / #################################
+// / Payees
+// / #################################
+
+// GetPayees returns every payee with its aliases and how many transactions it has, by name
+func GetPayees(db DBTX) ([]types.Payee, error) {
+	rows, err := db.Query(`
+		SELECT p.id, p.name, (SELECT COUNT(*) FROM transactions t WHERE t.payee_id = p.id)
+		FROM payees p
+		ORDER BY p.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payees: %w", err)
+	}
+
+	var payees []types.Payee
+	index := make(map[int]int)
+	for rows.Next() {
+		var payee types.Payee
+		if err := rows.Scan(&payee.ID, &payee.Name, &payee.Transactions); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read payee: %w", err)
+		}
+		index[payee.ID] = len(payees)
+		payees = append(payees, payee)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get payees: %w", err)
+	}
+
+	aliases, err := GetPayeeAliases(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		if i, ok := index[alias.PayeeID]; ok {
+			payees[i].Aliases = append(payees[i].Aliases, alias)
+		}
+	}
+	return payees, nil
+}
+
+// FindPayee returns the ID of the payee with a name, ignoring case, or 0 when there is none
+func FindPayee(db DBTX, name string) (int, error) {
+	var payeeID int
+	err := db.QueryRow(`SELECT id FROM payees WHERE name = ?`, strings.TrimSpace(name)).Scan(&payeeID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find payee: %w", err)
+	}
+	return payeeID, nil
+}
+
+// InsertPayee stores a new payee and returns its ID
+func InsertPayee(db DBTX, name string) (int, error) {
+	trimmedName := strings.TrimSpace(name)
+	if trimmedName == "" {
+		return 0, fmt.Errorf("payee name cannot be empty or whitespace only")
+	}
+
+	result, err := db.Exec(`INSERT INTO payees (name) VALUES (?)`, trimmedName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert payee: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inserted payee ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetTransactionPayee returns the ID and name of a transaction's payee, or 0 and "" when it has none
+func GetTransactionPayee(db DBTX, transactionID string) (int, string, error) {
+	var payeeID int
+	var name string
+	query := `SELECT COALESCE(p.id, 0), COALESCE(p.name, '')
+	          FROM transactions t
+	          LEFT JOIN payees p ON p.id = t.payee_id
+	          WHERE t.id = ?`
+	if err := db.QueryRow(query, transactionID).Scan(&payeeID, &name); err != nil {
+		return 0, "", fmt.Errorf("failed to get transaction payee: %w", err)
+	}
+	return payeeID, name, nil
+}
+
+// RenamePayee changes a payee's name
+func RenamePayee(db DBTX, payeeID int, name string) error {
+	trimmedName := strings.TrimSpace(name)
+	if trimmedName == "" {
+		return fmt.Errorf("payee name cannot be empty or whitespace only")
+	}
+
+	existing, err := FindPayee(db, trimmedName)
+	if err != nil {
+		return err
+	}
+	if existing != 0 && existing != payeeID {
+		return fmt.Errorf("a payee named '%s' already exists, merge the two instead", trimmedName)
+	}
+
+	if _, err := db.Exec(`UPDATE payees SET name = ? WHERE id = ?`, trimmedName, payeeID); err != nil {
+		return fmt.Errorf("failed to rename payee: %w", err)
+	}
+	return nil
+}
+
+// MergePayees moves the aliases, transactions and rules of one payee to another and deletes it, in a
+// single database transaction
+func MergePayees(db *sql.DB, fromID int, intoID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`UPDATE payee_aliases SET payee_id = ? WHERE payee_id = ?`,
+		`UPDATE transactions SET payee_id = ? WHERE payee_id = ?`,
+		`UPDATE rules SET payee_id = ? WHERE payee_id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, intoID, fromID); err != nil {
+			return fmt.Errorf("failed to merge payees: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM payees WHERE id = ?`, fromID); err != nil {
+		return fmt.Errorf("failed to delete merged payee: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// DeleteUnusedPayees removes payees that no transaction or rule refers to, along with their aliases,
+// unless they have a prefix alias someone set up. Returns how many were deleted
+func DeleteUnusedPayees(db DBTX) (int, error) {
+	result, err := db.Exec(`
+		DELETE FROM payees
+		WHERE id NOT IN (SELECT payee_id FROM transactions WHERE payee_id IS NOT NULL)
+		  AND id NOT IN (SELECT payee_id FROM rules WHERE payee_id IS NOT NULL)
+		  AND id NOT IN (SELECT payee_id FROM payee_aliases WHERE prefix = 1)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unused payees: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM payee_aliases WHERE payee_id NOT IN (SELECT id FROM payees)`); err != nil {
+		return 0, fmt.Errorf("failed to delete payee aliases: %w", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return int(deleted), nil
+}
+
+// GetPayeeAliases returns every payee alias
+func GetPayeeAliases(db DBTX) ([]types.PayeeAlias, error) {
+	rows, err := db.Query(`SELECT alias, payee_id, prefix FROM payee_aliases ORDER BY alias`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payee aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var aliases []types.PayeeAlias
+	for rows.Next() {
+		var alias types.PayeeAlias
+		if err := rows.Scan(&alias.Alias, &alias.PayeeID, &alias.Prefix); err != nil {
+			return nil, fmt.Errorf("failed to read payee alias: %w", err)
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// SetPayeeAlias points an alias at a payee, replacing whatever payee it belonged to
+func SetPayeeAlias(db DBTX, alias types.PayeeAlias) error {
+	query := `INSERT INTO payee_aliases (alias, payee_id, prefix) VALUES (?, ?, ?)
+	          ON CONFLICT (alias) DO UPDATE SET payee_id = excluded.payee_id, prefix = excluded.prefix`
+	if _, err := db.Exec(query, alias.Alias, alias.PayeeID, alias.Prefix); err != nil {
+		return fmt.Errorf("failed to store payee alias: %w", err)
+	}
+	return nil
+}
+
+// DeletePayeeAlias removes an alias
+func DeletePayeeAlias(db DBTX, alias string) error {
+	if _, err := db.Exec(`DELETE FROM payee_aliases WHERE alias = ?`, alias); err != nil {
+		return fmt.Errorf("failed to delete payee alias: %w", err)
+	}
+	return nil
+}
+
+// GetPayeeRewrites returns the stored description rewrites in the order they are applied
+func GetPayeeRewrites(db DBTX) ([]types.PayeeRewrite, error) {
+	rows, err := db.Query(`SELECT id, pattern, replacement FROM payee_rewrites ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payee rewrites: %w", err)
+	}
+	defer rows.Close()
+
+	var rewrites []types.PayeeRewrite
+	for rows.Next() {
+		var rewrite types.PayeeRewrite
+		if err := rows.Scan(&rewrite.ID, &rewrite.Pattern, &rewrite.Replacement); err != nil {
+			return nil, fmt.Errorf("failed to read payee rewrite: %w", err)
+		}
+		rewrites = append(rewrites, rewrite)
+	}
+	return rewrites, rows.Err()
+}
+
+// InsertPayeeRewrite stores a description rewrite and returns its ID
+func InsertPayeeRewrite(db DBTX, rewrite types.PayeeRewrite) (int, error) {
+	result, err := db.Exec(`INSERT INTO payee_rewrites (pattern, replacement) VALUES (?, ?)`, rewrite.Pattern, rewrite.Replacement)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert payee rewrite: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inserted payee rewrite ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// DeletePayeeRewrite removes a description rewrite
+func DeletePayeeRewrite(db DBTX, rewriteID int) error {
+	if _, err := db.Exec(`DELETE FROM payee_rewrites WHERE id = ?`, rewriteID); err != nil {
+		return fmt.Errorf("failed to delete payee rewrite: %w", err)
+	}
+	return nil
+}
+
+// / #################################
+// / Duplicates
+// / #################################
+
+// duplicatePairColumns selects two joined transactions, a and b, as a duplicate pair
+const duplicatePairColumns = `a.id, a.account_id, a.category_id, a.amount, a.transaction_date, a.description,
+	b.id, b.account_id, b.category_id, b.amount, b.transaction_date, b.description`
+
+// duplicatePairConditions matches transactions in the same account with the same amount within
+// a number of days of each other that came from two different imports and weren't dismissed.
+// Transactions added by hand have no import and split parts are left out, so neither is paired and a
+// split is not mistaken for a duplicate of what it was split from
+const duplicatePairConditions = `a.account_id = b.account_id
+	AND b.amount BETWEEN a.amount - 0.005 AND a.amount + 0.005
+	AND a.id != b.id
+	AND ABS(julianday(date(a.transaction_date)) - julianday(date(b.transaction_date))) <= ?
+	AND a.import_batch_id IS NOT NULL AND b.import_batch_id IS NOT NULL
+	AND a.import_batch_id != b.import_batch_id
+	AND a.split_from IS NULL AND b.split_from IS NULL
+	AND NOT EXISTS (SELECT 1 FROM dismissed_duplicates d
+	                WHERE (d.first_transaction_id = a.id AND d.second_transaction_id = b.id)
+	                   OR (d.first_transaction_id = b.id AND d.second_transaction_id = a.id))`
+
+// FindProbableDuplicates returns earlier transactions that look like the same purchase as the given one:
+// same account and amount, dates within windowDays and similar descriptions
+func FindProbableDuplicates(db DBTX, transactionID string, windowDays int) ([]types.DuplicatePair, error) {
+	query := `SELECT ` + duplicatePairColumns + `
+	          FROM transactions b
+	          JOIN transactions a ON ` + duplicatePairConditions + `
+	          WHERE b.id = ?
+	          ORDER BY a.transaction_date`
+	return queryDuplicatePairs(db, query, windowDays, transactionID)
+}
+
+// ScanProbableDuplicates returns every pair of stored transactions that look like the same purchase.
+// The older row of each pair is returned as the existing transaction
+func ScanProbableDuplicates(db DBTX, windowDays int) ([]types.DuplicatePair, error) {
+	query := `SELECT ` + duplicatePairColumns + `
+	          FROM transactions a
+	          JOIN transactions b ON a.rowid < b.rowid AND ` + duplicatePairConditions + `
+	          ORDER BY a.transaction_date, b.transaction_date`
+	return queryDuplicatePairs(db, query, windowDays)
+}
+
+// queryDuplicatePairs runs a duplicate pair query and keeps the pairs with similar descriptions
+func queryDuplicatePairs(db DBTX, query string, args ...any) ([]types.DuplicatePair, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var pairs []types.DuplicatePair
+	for rows.Next() {
+		var pair types.DuplicatePair
+		a, b := &pair.Existing, &pair.Duplicate
+		err := rows.Scan(&a.Id, &a.AccountID, &a.CategoryID, &a.Amount, &a.Date, &a.Description,
+			&b.Id, &b.AccountID, &b.CategoryID, &b.Amount, &b.Date, &b.Description)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		pair.Similarity = txnUtils.DescriptionSimilarity(a.Description, b.Description)
+		if pair.Similarity >= txnUtils.SimilarDescriptionThreshold {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return pairs, nil
+}
+
+// MergeTransactions folds a duplicate transaction into the one being kept. The duplicate's
+// fingerprint is remembered so importing it again is skipped, metadata the kept transaction
+// lacks is copied over and, with adoptDetails, the kept transaction takes the duplicate's
+// date and description (e.g. the posted version of a pending charge)
+func MergeTransactions(db *sql.DB, keepID string, duplicateID string, adoptDetails bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var accountID int
+	var fingerprint sql.NullString
+	err = tx.QueryRow(`SELECT account_id, import_fingerprint FROM transactions WHERE id = ?`, duplicateID).Scan(&accountID, &fingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate transaction: %w", err)
+	}
+
+	if fingerprint.Valid {
+		query := `INSERT OR REPLACE INTO transaction_aliases (account_id, fingerprint, transaction_id) VALUES (?, ?, ?)`
+		if _, err := tx.Exec(query, accountID, fingerprint.String, keepID); err != nil {
+			return fmt.Errorf("failed to remember duplicate fingerprint: %w", err)
+		}
+	}
+
+	// Aliases of the duplicate now point at the kept transaction
+	if _, err := tx.Exec(`UPDATE transaction_aliases SET transaction_id = ? WHERE transaction_id = ?`, keepID, duplicateID); err != nil {
+		return fmt.Errorf("failed to move fingerprint aliases: %w", err)
+	}
+
+	query := `INSERT OR IGNORE INTO transaction_metadata (transaction_id, field, value)
+	          SELECT ?, field, value FROM transaction_metadata WHERE transaction_id = ?`
+	if _, err := tx.Exec(query, keepID, duplicateID); err != nil {
+		return fmt.Errorf("failed to copy metadata: %w", err)
+	}
+
+	if adoptDetails {
+		query := `UPDATE transactions
+		          SET (transaction_date, description, raw_description, payee_id) =
+		              (SELECT transaction_date, description, raw_description, payee_id FROM transactions WHERE id = ?)
+		          WHERE id = ?`
+		if _, err := tx.Exec(query, duplicateID, keepID); err != nil {
+			return fmt.Errorf("failed to update kept transaction: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM transactions WHERE id = ?`, duplicateID); err != nil {
+		return fmt.Errorf("failed to delete duplicate transaction: %w", err)
+	}
+
+	if err := DeleteOrphanedTransactionData(tx); err != nil {
+		return fmt.Errorf("failed to clean up transaction data: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// DismissDuplicate records that two similar transactions are both real so they aren't flagged again
+func DismissDuplicate(db DBTX, firstID string, secondID string) error {
+	if secondID < firstID {
+		firstID, secondID = secondID, firstID
+	}
+	query := `INSERT OR IGNORE INTO dismissed_duplicates (first_transaction_id, second_transaction_id) VALUES (?, ?)`
+	_, err := db.Exec(query, firstID, secondID)
+	return err
+}
+
+// / #################################
+// / Transfers
+// / #################################
+
+// linkedTransferIDs selects the transactions that already belong to a transfer pair. Transactions a rule
+// marked as a transfer can still be paired with their other side
+const linkedTransferIDs = `SELECT from_transaction_id FROM transfers WHERE status != 'broken'
+	UNION SELECT to_transaction_id FROM transfers WHERE status != 'broken'`
+
+// LinkTransfers pairs money leaving one account with the same amount arriving in another account
+// within windowDays and links each pair as a suggested transfer. With a batchID only pairs that include
+// a transaction from that import are looked for, otherwise every stored transaction is considered.
+// Closest dates are paired first, each transaction is used at most once and pairs the user broke are
+// never suggested again. Returns the number of new transfers
+func LinkTransfers(db DBTX, windowDays int, batchID int) (int, error) {
+	// n is a transaction that may need linking and m a candidate for its other side
+	candidates := "n.amount < 0"
+	args := []any{windowDays}
+	if batchID != 0 {
+		candidates = "n.import_batch_id = ? AND n.amount != 0"
+		args = append(args, batchID)
+	}
+	query := `SELECT CASE WHEN n.amount < 0 THEN n.id ELSE m.id END,
+	                 CASE WHEN n.amount < 0 THEN m.id ELSE n.id END
+	          FROM transactions n
+	          JOIN transactions m ON m.amount BETWEEN -n.amount - 0.005 AND -n.amount + 0.005
+	              AND m.account_id != n.account_id
+	              AND ABS(julianday(date(n.transaction_date)) - julianday(date(m.transaction_date))) <= ?
+	          WHERE ` + candidates + `
+	              AND n.id NOT IN (` + linkedTransferIDs + `)
+	              AND m.id NOT IN (` + linkedTransferIDs + `)
+	              AND NOT EXISTS (SELECT 1 FROM transfers x
+	                              WHERE (x.from_transaction_id = n.id AND x.to_transaction_id = m.id)
+	                                 OR (x.from_transaction_id = m.id AND x.to_transaction_id = n.id))
+	          ORDER BY ABS(julianday(date(n.transaction_date)) - julianday(date(m.transaction_date))),
+	                   MIN(n.transaction_date, m.transaction_date)`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not execute query: %w", err)
+	}
+
+	var pairs [][2]string
+	used := make(map[string]bool)
+	for rows.Next() {
+		var fromID, toID string
+		if err := rows.Scan(&fromID, &toID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan row: %w", err)
+		}
+		if used[fromID] || used[toID] {
+			continue
+		}
+		used[fromID] = true
+		used[toID] = true
+		pairs = append(pairs, [2]string{fromID, toID})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	for _, pair := range pairs {
+		query := `INSERT INTO transfers (from_transaction_id, to_transaction_id, status) VALUES (?, ?, ?)`
+		if _, err := db.Exec(query, pair[0], pair[1], types.TransferSuggested); err != nil {
+			return 0, fmt.Errorf("failed to link transfer: %w", err)
+		}
+	}
+
+	return len(pairs), nil
+}
+
+// GetTransfers returns every transfer that wasn't broken, oldest first
+func GetTransfers(db DBTX) ([]types.Transfer, error) {
+	query := `SELECT x.id, x.status,
+	                 o.id, o.account_id, o.category_id, o.amount, o.transaction_date, o.description, oa.name,
+	                 i.id, i.account_id, i.category_id, i.amount, i.transaction_date, i.description, ia.name
+	          FROM transfers x
+	          JOIN transactions o ON o.id = x.from_transaction_id
+	          JOIN accounts oa ON oa.id = o.account_id
+	          JOIN transactions i ON i.id = x.to_transaction_id
+	          JOIN accounts ia ON ia.id = i.account_id
+	          WHERE x.status != ?
+	          ORDER BY o.transaction_date, x.id`
+
+	rows, err := db.Query(query, types.TransferBroken)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var transfers []types.Transfer
+	for rows.Next() {
+		var transfer types.Transfer
+		from, to := &transfer.From, &transfer.To
+		err := rows.Scan(&transfer.ID, &transfer.Status,
+			&from.Id, &from.AccountID, &from.CategoryID, &from.Amount, &from.Date, &from.Description, &transfer.FromAccount,
+			&to.Id, &to.AccountID, &to.CategoryID, &to.Amount, &to.Date, &to.Description, &transfer.ToAccount)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return transfers, nil
+}
+
+// SetTransferStatus confirms or breaks a transfer. Broken transfers are kept so the pair isn't linked again
+func SetTransferStatus(db DBTX, transferID int, status string) error {
+	result, err := db.Exec(`UPDATE transfers SET status = ? WHERE id = ?`, status, transferID)
+	if err != nil {
+		return fmt.Errorf("failed to update transfer: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no transfer found with ID %d", transferID)
+	}
+	return nil
+}
+
+// / #################################
+// / Import Batches
+// / #################################
+
+// InsertImportBatch records the start of an import run and returns the batch ID
+func InsertImportBatch(db DBTX, fileName string, checksum string) (int, error) {
+	query := `INSERT INTO import_batches (file_name, file_checksum) VALUES (?, ?)`
+	result, err := db.Exec(query, fileName, checksum)
+	if err != nil {
+		return 0, err
+	}
+
+	batchID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(batchID), nil
+}
+
+// CompleteImportBatch stores the outcome of a finished import run
+func CompleteImportBatch(db DBTX, batch types.ImportBatch) error {
+	query := `UPDATE import_batches
+	          SET format = ?, account_name = ?, total_read = ?, total_skipped = ?, total_added = ?, completed_at = CURRENT_TIMESTAMP
+	          WHERE id = ?`
+	_, err := db.Exec(query, batch.Format, batch.AccountName, batch.TotalRead, batch.TotalSkipped, batch.TotalAdded, batch.ID)
+	return err
+}
+
+// GetImportBatches returns every recorded import, newest first
+func GetImportBatches(db DBTX) ([]types.ImportBatch, error) {
+	query := `SELECT b.id, b.file_name, b.file_checksum, COALESCE(b.format, ''), COALESCE(b.account_name, ''),
+	                 b.started_at, b.completed_at, b.rolled_back_at, b.total_read, b.total_skipped, b.total_added,
+	                 (SELECT COUNT(*) FROM transactions t WHERE t.import_batch_id = b.id),
+	                 (SELECT COUNT(*) FROM account_snapshots s WHERE s.import_batch_id = b.id)
+	          FROM import_batches b
+	          ORDER BY b.id DESC`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []types.ImportBatch
+	for rows.Next() {
+		var batch types.ImportBatch
+		var completedAt, rolledBackAt sql.NullTime
+		err := rows.Scan(&batch.ID, &batch.FileName, &batch.Checksum, &batch.Format, &batch.AccountName,
+			&batch.StartedAt, &completedAt, &rolledBackAt, &batch.TotalRead, &batch.TotalSkipped, &batch.TotalAdded,
+			&batch.TransactionCount, &batch.SnapshotCount)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		if completedAt.Valid {
+			batch.CompletedAt = &completedAt.Time
+		}
+		if rolledBackAt.Valid {
+			batch.RolledBackAt = &rolledBackAt.Time
+		}
+		batches = append(batches, batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return batches, nil
+}
+
+// FindImportBatchByChecksum returns the ID of an earlier import of the same file that wasn't rolled back, or 0
+func FindImportBatchByChecksum(db DBTX, checksum string) (int, error) {
+	var batchID int
+	query := `SELECT id FROM import_batches WHERE file_checksum = ? AND rolled_back_at IS NULL ORDER BY id DESC LIMIT 1`
+	err := db.QueryRow(query, checksum).Scan(&batchID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return batchID, err
+}
+
+// RollbackImportBatch deletes every transaction and account snapshot created by an import batch
+// in a single database transaction and marks the batch as rolled back
+func RollbackImportBatch(db *sql.DB, batchID int) (int64, int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM transactions WHERE import_batch_id = ?`, batchID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete transactions: %w", err)
+	}
+	transactionsDeleted, _ := result.RowsAffected()
+
+	if err := DeleteOrphanedTransactionData(tx); err != nil {
+		return 0, 0, fmt.Errorf("failed to clean up transaction data: %w", err)
+	}
+
+	result, err = tx.Exec(`DELETE FROM account_snapshots WHERE import_batch_id = ?`, batchID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete account snapshots: %w", err)
+	}
+	snapshotsDeleted, _ := result.RowsAffected()
+
+	_, err = tx.Exec(`UPDATE import_batches SET rolled_back_at = CURRENT_TIMESTAMP WHERE id = ?`, batchID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to mark batch as rolled back: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit rollback: %w", err)
+	}
+
+	return transactionsDeleted, snapshotsDeleted, nil
+}
+
 // / #################################
 // / Budgets
 // / #################################
@@ -0,0 +1,225 @@
+package dataparse
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// camtDocument covers both camt.053 statements and camt.052 intraday reports
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+	Reports    []camtStatement `xml:"BkToCstmrAcctRpt>Rpt"`
+}
+
+type camtStatement struct {
+	IBAN     string        `xml:"Acct>Id>IBAN"`
+	OtherID  string        `xml:"Acct>Id>Othr>Id"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code      string   `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    string   `xml:"Amt"`
+	Indicator string   `xml:"CdtDbtInd"`
+	Date      camtDate `xml:"Dt"`
+}
+
+type camtEntry struct {
+	Amount         string          `xml:"Amt"`
+	Indicator      string          `xml:"CdtDbtInd"`
+	Status         camtStatus      `xml:"Sts"`
+	BookingDate    camtDate        `xml:"BookgDt"`
+	Reference      string          `xml:"AcctSvcrRef"`
+	EntryReference string          `xml:"NtryRef"`
+	AdditionalInfo string          `xml:"AddtlNtryInf"`
+	Details        []camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+// camtStatus is plain text in older schema versions and wrapped in <Cd> in newer ones
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtTxDetails struct {
+	Reference    string   `xml:"Refs>AcctSvcrRef"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+	CreditorName string   `xml:"RltdPties>Cdtr>Nm"`
+	DebtorName   string   `xml:"RltdPties>Dbtr>Nm"`
+}
+
+// IsCamtFile sniffs the start of a file for an ISO 20022 camt.052/camt.053 namespace
+func IsCamtFile(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, 4096)
+	n, _ := io.ReadFull(file, head)
+	content := string(head[:n])
+
+	return strings.Contains(content, "<Document") &&
+		(strings.Contains(content, "camt.053") || strings.Contains(content, "camt.052"))
+}
+
+// ParseCamt parses an ISO 20022 camt.053 statement or camt.052 report.
+// Each statement in the file is returned separately since they can belong to different accounts
+func ParseCamt(filePath string) ([]types.ParsedStatement, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	var document camtDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("error reading camt XML: %w", err)
+	}
+
+	var statements []types.ParsedStatement
+	for _, stmt := range append(document.Statements, document.Reports...) {
+		statement := types.ParsedStatement{AccountID: stmt.IBAN}
+		if statement.AccountID == "" {
+			statement.AccountID = stmt.OtherID
+		}
+
+		var rawTransactions []types.GenericTransaction
+		for i, entry := range stmt.Entries {
+			transaction, err := convertCamtEntry(entry)
+			if err != nil {
+				statement.Skipped = skipRow(statement.Skipped, fmt.Sprintf("entry %d", i+1), transaction.Description, err.Error())
+				continue
+			}
+			rawTransactions = append(rawTransactions, transaction)
+		}
+		statement.Transactions = ProcessGenericTransactionsWithDailySequence(rawTransactions)
+
+		// Record the closing booked balance
+		for _, balance := range stmt.Balances {
+			if balance.Code != "CLBD" {
+				continue
+			}
+			amount, err := parseCamtAmount(balance.Amount, balance.Indicator)
+			if err != nil {
+				fmt.Printf("Skipping closing balance: invalid amount: %v\n", err)
+				continue
+			}
+			date, err := balance.Date.parse()
+			if err != nil {
+				fmt.Printf("Skipping closing balance: invalid date: %v\n", err)
+				continue
+			}
+			statement.ClosingBalance = &amount
+			statement.BalanceDate = date
+		}
+
+		statements = append(statements, statement)
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no statements found in camt file")
+	}
+
+	return statements, nil
+}
+
+// convertCamtEntry turns a booked <Ntry> into a generic transaction. On error the returned
+// transaction still carries whatever description could be read, for reporting
+func convertCamtEntry(entry camtEntry) (types.GenericTransaction, error) {
+	amount, amountErr := parseCamtAmount(entry.Amount, entry.Indicator)
+
+	var description, externalID string
+	if len(entry.Details) > 0 {
+		details := entry.Details[0]
+		description = strings.Join(strings.Fields(strings.Join(details.Unstructured, " ")), " ")
+		if description == "" {
+			// Name the other party when there's no remittance information
+			if amount < 0 {
+				description = details.CreditorName
+			} else {
+				description = details.DebtorName
+			}
+		}
+		externalID = details.Reference
+	}
+	if description == "" {
+		description = strings.TrimSpace(entry.AdditionalInfo)
+	}
+	// The bank's own references identify an entry. EndToEndId is set by the payer, isn't unique per
+	// entry and is often NOTPROVIDED, so it isn't used
+	externalID = camtReference(entry.Reference, entry.EntryReference, externalID)
+
+	transaction := types.GenericTransaction{
+		Description: description,
+		Amount:      amount,
+		ExternalID:  externalID,
+	}
+
+	status := strings.TrimSpace(entry.Status.Code)
+	if status == "" {
+		status = strings.TrimSpace(entry.Status.Text)
+	}
+	if status == "PDNG" {
+		return transaction, fmt.Errorf("pending")
+	}
+
+	date, err := entry.BookingDate.parse()
+	if err != nil {
+		return transaction, fmt.Errorf("invalid date format: %w", err)
+	}
+	if amountErr != nil {
+		return transaction, fmt.Errorf("invalid amount: %w", amountErr)
+	}
+
+	transaction.Date = date
+	return transaction, nil
+}
+
+// parseCamtAmount parses an unsigned camt amount and applies the credit/debit indicator
+func parseCamtAmount(value string, indicator string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(indicator) == "DBIT" {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// parse returns the date of a camt date choice, which holds either <Dt> or <DtTm>
+func (d camtDate) parse() (time.Time, error) {
+	value := strings.TrimSpace(d.Date)
+	if value == "" {
+		value = strings.TrimSpace(d.DateTime)
+	}
+	if len(value) < 10 {
+		return time.Time{}, fmt.Errorf("date '%s' is too short", value)
+	}
+	return time.Parse("2006-01-02", value[:10])
+}
+
+// camtReference returns the first reference that is set, skipping the NOTPROVIDED placeholder
+func camtReference(references ...string) string {
+	for _, reference := range references {
+		reference = strings.TrimSpace(reference)
+		if reference != "" && !strings.EqualFold(reference, "NOTPROVIDED") {
+			return reference
+		}
+	}
+	return ""
+}
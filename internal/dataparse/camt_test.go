@@ -0,0 +1,64 @@
+package dataparse
+
+import "testing"
+
+func TestParseCamt(t *testing.T) {
+	statements, err := ParseCamt(testFile("statement.camt053.xml"))
+	if err != nil {
+		t.Fatalf("ParseCamt: %v", err)
+	}
+	if len(statements) != 1 {
+		t.Fatalf("got %d statements, want 1", len(statements))
+	}
+
+	statement := statements[0]
+	if statement.AccountID != "DE89370400440532013000" {
+		t.Errorf("account ID %q, want the IBAN", statement.AccountID)
+	}
+	checkBalance(t, statement.ClosingBalance, ptr(1234.56))
+	if got := statement.BalanceDate.Format("2006-01-02"); got != "2024-03-31" {
+		t.Errorf("balance date %s, want 2024-03-31", got)
+	}
+
+	checkTransactions(t, statement.Transactions, []expected{
+		{date: "2024-03-05", description: "Strom Maerz Kunde 42", amount: -45, externalID: "BANKREF-1"},
+		{date: "2024-03-10", description: "Arbeitgeber GmbH", amount: 2500, externalID: "NTRY-2"},
+		{date: "2024-03-12", description: "Kontofuehrung", amount: -9.99, externalID: "TX-REF-3"},
+		{date: "2024-03-12", description: "Ohne Referenz", amount: -5},
+	})
+	checkSkipped(t, statement.Skipped, []string{"pending"})
+}
+
+func TestIsCamtFile(t *testing.T) {
+	tests := map[string]bool{
+		"statement.camt053.xml": true,
+		"statement.qfx":         false,
+		"missing.xml":           false,
+	}
+
+	for file, want := range tests {
+		if got := IsCamtFile(testFile(file)); got != want {
+			t.Errorf("IsCamtFile(%s) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestCamtReference(t *testing.T) {
+	tests := []struct {
+		references []string
+		want       string
+	}{
+		{[]string{"ACCT", "NTRY", "TX"}, "ACCT"},
+		{[]string{"", "NTRY", "TX"}, "NTRY"},
+		{[]string{"NOTPROVIDED", " notprovided ", "TX"}, "TX"},
+		{[]string{" ACCT "}, "ACCT"},
+		{[]string{"", "NOTPROVIDED"}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := camtReference(tt.references...); got != tt.want {
+			t.Errorf("camtReference(%q) = %q, want %q", tt.references, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package dataparse
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/transaction/utils"
+)
+
+// templatePlaceholder matches a {Column} reference in a description template
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// descriptionTemplate builds a description from several columns of a row
+type descriptionTemplate struct {
+	prefix  string
+	columns []templateColumn
+	suffix  string
+}
+
+// templateColumn is a column referenced by a template and the text written before it
+type templateColumn struct {
+	separator string
+	index     int
+}
+
+// templateColumnNames lists the column names referenced by a description template
+func templateColumnNames(template string) []string {
+	var names []string
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// newDescriptionTemplate resolves the columns of a template like "{Payee} - {Memo}" against the header row.
+// Returns nil when no template is configured
+func newDescriptionTemplate(headers []string, template string) (*descriptionTemplate, error) {
+	if template == "" {
+		return nil, nil
+	}
+
+	matches := templatePlaceholder.FindAllStringSubmatchIndex(template, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("description template '%s' doesn't reference any columns", template)
+	}
+
+	result := &descriptionTemplate{prefix: template[:matches[0][0]]}
+	last := 0
+	for i, match := range matches {
+		index, err := utils.GetColumnIndex(headers, template[match[2]:match[3]])
+		if err != nil {
+			return nil, fmt.Errorf("description template error: %w", err)
+		}
+
+		separator := ""
+		if i > 0 {
+			separator = template[last:match[0]]
+		}
+		result.columns = append(result.columns, templateColumn{separator: separator, index: index})
+		last = match[1]
+	}
+	result.suffix = template[last:]
+
+	return result, nil
+}
+
+// build fills in the template for a row. Empty columns are left out along with the separator before them
+func (t *descriptionTemplate) build(row []string) string {
+	var b strings.Builder
+	wrote := false
+	for _, column := range t.columns {
+		value := cellValue(row, column.index)
+		if value == "" {
+			continue
+		}
+		if wrote {
+			b.WriteString(column.separator)
+		}
+		b.WriteString(value)
+		wrote = true
+	}
+
+	if !wrote {
+		return ""
+	}
+	return strings.TrimSpace(t.prefix + b.String() + t.suffix)
+}
+
+// findMetadataColumns resolves the metadata field to column mapping against the header row
+func findMetadataColumns(headers []string, metadata map[string]string) (map[string]int, error) {
+	columns := make(map[string]int, len(metadata))
+	for field, column := range metadata {
+		index, err := utils.GetColumnIndex(headers, column)
+		if err != nil {
+			return nil, fmt.Errorf("metadata column error for '%s': %w", field, err)
+		}
+		columns[field] = index
+	}
+	return columns, nil
+}
+
+// rowMetadata reads the non-empty metadata values of a row
+func rowMetadata(row []string, columns map[string]int) map[string]string {
+	if len(columns) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string)
+	for field, index := range columns {
+		if value := cellValue(row, index); value != "" {
+			metadata[field] = value
+		}
+	}
+	return metadata
+}
+
+// cellValue returns a trimmed cell, or "" when the row is too short
+func cellValue(row []string, index int) string {
+	if index < 0 || index >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[index])
+}
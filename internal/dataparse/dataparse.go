@@ -3,10 +3,11 @@ package dataparse
 import (
 	"encoding/csv"
 	"fmt"
+	"math"
 	"os"
-	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"slices"
 
@@ -16,91 +17,109 @@ import (
 )
 
 // ParseGenericCSV parses a CSV file using the provided import format configuration
-func ParseGenericCSV(filePath string, format *types.ImportFormat) ([]types.GenericTransaction, error) {
-	file, err := os.Open(filePath)
+func ParseGenericCSV(filePath string, format *types.ImportFormat) ([]types.GenericTransaction, []types.SkippedRow, error) {
+	records, err := ReadCSVRecords(filePath, format)
 	if err != nil {
-		return nil, fmt.Errorf("error opening file: %w", err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("error reading CSV: %w", err)
+		return nil, nil, err
 	}
 
 	if len(records) == 0 {
-		return nil, fmt.Errorf("CSV file is empty")
+		return nil, nil, fmt.Errorf("CSV file is empty")
 	}
 
 	// Get headers and find column indices
-	headers := records[0]
+	headerRow, err := findHeaderRow(records, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers := records[headerRow]
 
-	startRow := 1
+	startRow := headerRow + 1
+	records = dropFooterRows(records, startRow, format)
 
 	if len(records) <= startRow {
-		return nil, fmt.Errorf("CSV file has no data rows")
+		return nil, nil, fmt.Errorf("CSV file has no data rows")
 	}
 
 	// Find column indices
 	dateIndex, err := utils.GetColumnIndex(headers, format.ColumnMapping.Date)
 	if err != nil {
-		return nil, fmt.Errorf("date column error: %w", err)
+		return nil, nil, fmt.Errorf("date column error: %w", err)
+	}
+
+	// The description comes from a single column or is built from a template
+	descIndex := -1
+	if format.ColumnMapping.Description != "" {
+		descIndex, err = utils.GetColumnIndex(headers, format.ColumnMapping.Description)
+		if err != nil {
+			return nil, nil, fmt.Errorf("description column error: %w", err)
+		}
+	} else if format.ColumnMapping.DescriptionTemplate == "" {
+		return nil, nil, fmt.Errorf("description column error: column_mapping needs a description column or description_template")
+	}
+
+	template, err := newDescriptionTemplate(headers, format.ColumnMapping.DescriptionTemplate)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	descIndex, err := utils.GetColumnIndex(headers, format.ColumnMapping.Description)
+	metadataColumns, err := findMetadataColumns(headers, format.ColumnMapping.Metadata)
 	if err != nil {
-		return nil, fmt.Errorf("description column error: %w", err)
+		return nil, nil, err
 	}
 
-	amountIndex, err := utils.GetColumnIndex(headers, format.ColumnMapping.Amount)
+	amountColumns, err := findAmountColumns(headers, format.ColumnMapping)
 	if err != nil {
-		return nil, fmt.Errorf("amount column error: %w", err)
+		return nil, nil, err
 	}
 
 	var balanceIndex int = -1
 	if format.ColumnMapping.Balance != "" {
 		balanceIndex, err = utils.GetColumnIndex(headers, format.ColumnMapping.Balance)
 		if err != nil {
-			return nil, fmt.Errorf("balance column error: %w", err)
+			return nil, nil, fmt.Errorf("balance column error: %w", err)
 		}
 	}
 
 	var rawTransactions []types.GenericTransaction
+	var skipped []types.SkippedRow
 
 	// Parse each row
 	for i, row := range records[startRow:] {
-		rowNum := i + startRow + 1
+		rowLabel := fmt.Sprintf("row %d", i+startRow+format.SkipLines+1)
 
-		if len(row) <= maxIndex(dateIndex, descIndex, amountIndex, balanceIndex) {
-			fmt.Printf("Skipping row %d: not enough fields\n", rowNum)
+		if len(row) <= maxIndex(dateIndex, descIndex, amountColumns.amount, amountColumns.debit, amountColumns.credit, amountColumns.kind, balanceIndex) {
+			skipped = skipRow(skipped, rowLabel, strings.Join(row, ","), "not enough fields")
 			continue
 		}
 
+		var description string
+		if template != nil {
+			description = template.build(row)
+		} else {
+			description = strings.TrimSpace(row[descIndex])
+		}
+
 		// Parse date
 		date, err := time.Parse(format.DateFormat, strings.TrimSpace(row[dateIndex]))
 		if err != nil {
-			fmt.Printf("Skipping row %d: invalid date format: %v\n", rowNum, err)
+			skipped = skipRow(skipped, rowLabel, description, fmt.Sprintf("invalid date format: %v", err))
 			continue
 		}
 
 		// Parse amount
-		amountStr := strings.TrimSpace(row[amountIndex])
-		amount, err := strconv.ParseFloat(amountStr, 64)
+		amount, err := parseRowAmount(row, amountColumns, format)
 		if err != nil {
-			fmt.Printf("Skipping row %d: invalid amount: %v\n", rowNum, err)
+			skipped = skipRow(skipped, rowLabel, description, fmt.Sprintf("invalid amount: %v", err))
 			continue
 		}
 
-		// Apply amount multiplier
-		amount *= format.AmountMultiplier
-
 		// Parse balance if configured
 		var balance *float64
 		if balanceIndex >= 0 {
 			balanceStr := strings.TrimSpace(row[balanceIndex])
 			if balanceStr != "" {
-				bal, err := strconv.ParseFloat(balanceStr, 64)
+				bal, err := ParseMoney(balanceStr, format.MoneyFormat)
 				if err != nil {
 					cliUtils.PrintWarning("parsing balance", err)
 				} else {
@@ -109,11 +128,9 @@ func ParseGenericCSV(filePath string, format *types.ImportFormat) ([]types.Gener
 			}
 		}
 
-		description := strings.TrimSpace(row[descIndex])
-
 		// Apply blacklist filters
 		if isBlacklisted(description, amount, format) {
-			fmt.Printf("Skipping blacklisted transaction: %s\n", description)
+			skipped = skipBlacklisted(skipped, rowLabel, description)
 			continue
 		}
 
@@ -122,11 +139,316 @@ func ParseGenericCSV(filePath string, format *types.ImportFormat) ([]types.Gener
 			Description: description,
 			Amount:      amount,
 			Balance:     balance,
+			Metadata:    rowMetadata(row, metadataColumns),
 		})
 	}
 
 	// Process transactions to assign daily sequences
-	return ProcessGenericTransactionsWithDailySequence(rawTransactions), nil
+	return ProcessGenericTransactionsWithDailySequence(rawTransactions), skipped, nil
+}
+
+// FilterBlacklisted removes transactions matching the format's blacklists. Used by parsers
+// that don't have the import format available while reading the file
+func FilterBlacklisted(transactions []types.GenericTransaction, format *types.ImportFormat) ([]types.GenericTransaction, []types.SkippedRow) {
+	var filtered []types.GenericTransaction
+	var skipped []types.SkippedRow
+	for _, tx := range transactions {
+		if isBlacklisted(tx.Description, tx.Amount, format) {
+			skipped = skipBlacklisted(skipped, tx.Date.Format("2006-01-02"), tx.Description)
+			continue
+		}
+		filtered = append(filtered, tx)
+	}
+	return filtered, skipped
+}
+
+// skipRow prints why a row is being skipped and records it for the import report
+func skipRow(skipped []types.SkippedRow, row string, description string, reason string) []types.SkippedRow {
+	fmt.Printf("Skipping %s: %s\n", row, reason)
+	return append(skipped, types.SkippedRow{Row: row, Description: description, Reason: reason})
+}
+
+// skipBlacklisted prints and records a transaction removed by the format's blacklists
+func skipBlacklisted(skipped []types.SkippedRow, row string, description string) []types.SkippedRow {
+	fmt.Printf("Skipping blacklisted transaction: %s\n", description)
+	return append(skipped, types.SkippedRow{Row: row, Description: description, Reason: "blacklisted", Blacklisted: true})
+}
+
+// ReadCSVRecords decodes a CSV file using the format's encoding and delimiter, skipping any
+// configured preamble lines. Rows may have differing numbers of fields
+func ReadCSVRecords(filePath string, format *types.ImportFormat) ([][]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	content, err := decodeText(data, format.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding CSV: %w", err)
+	}
+
+	// Preamble lines are dropped before parsing since they often aren't valid CSV
+	for i := 0; i < format.SkipLines && content != ""; i++ {
+		if idx := strings.IndexByte(content, '\n'); idx >= 0 {
+			content = content[idx+1:]
+		} else {
+			content = ""
+		}
+	}
+
+	delimiter, err := csvDelimiter(format.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+
+	return records, nil
+}
+
+// MatchHeaderColumns reads a CSV with the format's dialect and reports how many of the format's
+// mapped columns appear in its header row, along with the number of mapped columns
+func MatchHeaderColumns(filePath string, format *types.ImportFormat) (int, int) {
+	columns := mappedColumns(format.ColumnMapping)
+
+	records, err := ReadCSVRecords(filePath, format)
+	if err != nil || len(records) == 0 {
+		return 0, len(columns)
+	}
+
+	headerRow, err := findHeaderRow(records, format)
+	if err != nil {
+		return 0, len(columns)
+	}
+
+	found := 0
+	for _, column := range columns {
+		if _, err := utils.GetColumnIndex(records[headerRow], column); err == nil {
+			found++
+		}
+	}
+	return found, len(columns)
+}
+
+// mappedColumns lists the CSV column names used by a column mapping
+func mappedColumns(mapping types.ColumnMapping) []string {
+	names := []string{mapping.Date, mapping.Description, mapping.Amount, mapping.Debit, mapping.Credit, mapping.Type, mapping.Balance}
+	names = append(names, templateColumnNames(mapping.DescriptionTemplate)...)
+	for _, column := range mapping.Metadata {
+		names = append(names, column)
+	}
+
+	var columns []string
+	for _, column := range names {
+		if column != "" && !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// csvDelimiter converts the configured delimiter to a rune, defaulting to a comma
+func csvDelimiter(delimiter string) (rune, error) {
+	switch delimiter {
+	case "":
+		return ',', nil
+	case "tab", "\\t", "\t":
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter '%s', it must be a single character", delimiter)
+	}
+	return r, nil
+}
+
+// findHeaderRow returns the index of the header row. It is the first row unless find_header
+// is set, in which case it is the first row containing the mapped date and description columns
+func findHeaderRow(records [][]string, format *types.ImportFormat) (int, error) {
+	if !format.FindHeader {
+		return 0, nil
+	}
+
+	// With a description template, its first column stands in for the description column
+	descColumn := format.ColumnMapping.Description
+	if descColumn == "" {
+		if names := templateColumnNames(format.ColumnMapping.DescriptionTemplate); len(names) > 0 {
+			descColumn = names[0]
+		}
+	}
+
+	for i, row := range records {
+		_, dateErr := utils.GetColumnIndex(row, format.ColumnMapping.Date)
+		_, descErr := utils.GetColumnIndex(row, descColumn)
+		if dateErr == nil && descErr == nil {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no header row containing columns '%s' and '%s' found", format.ColumnMapping.Date, descColumn)
+}
+
+// dropFooterRows removes the configured number of trailing rows and everything from the first
+// row starting with a footer marker (e.g. "Total") onwards
+func dropFooterRows(records [][]string, startRow int, format *types.ImportFormat) [][]string {
+	end := len(records) - format.SkipFooterLines
+	if end < startRow {
+		end = startRow
+	}
+
+	for i := startRow; i < end; i++ {
+		if isFooterRow(records[i], format.FooterMarkers) {
+			end = i
+			break
+		}
+	}
+
+	return records[:end]
+}
+
+// isFooterRow checks whether the first non-empty cell of a row starts with a footer marker
+func isFooterRow(row []string, markers []string) bool {
+	for _, cell := range row {
+		cell = strings.TrimSpace(cell)
+		if cell == "" {
+			continue
+		}
+		for _, marker := range markers {
+			if strings.HasPrefix(strings.ToLower(cell), strings.ToLower(marker)) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// amountColumns holds the indices of the columns that make up a row's amount, -1 when unused
+type amountColumns struct {
+	amount int
+	debit  int
+	credit int
+	kind   int
+}
+
+// findAmountColumns locates the amount related columns. Either a signed amount column or
+// separate debit/credit columns must be mapped
+func findAmountColumns(headers []string, mapping types.ColumnMapping) (amountColumns, error) {
+	columns := amountColumns{amount: -1, debit: -1, credit: -1, kind: -1}
+	var err error
+
+	if mapping.Amount == "" && mapping.Debit == "" && mapping.Credit == "" {
+		return columns, fmt.Errorf("amount column error: column_mapping needs an amount column or debit/credit columns")
+	}
+
+	if mapping.Amount != "" {
+		if columns.amount, err = utils.GetColumnIndex(headers, mapping.Amount); err != nil {
+			return columns, fmt.Errorf("amount column error: %w", err)
+		}
+	}
+	if mapping.Debit != "" {
+		if columns.debit, err = utils.GetColumnIndex(headers, mapping.Debit); err != nil {
+			return columns, fmt.Errorf("debit column error: %w", err)
+		}
+	}
+	if mapping.Credit != "" {
+		if columns.credit, err = utils.GetColumnIndex(headers, mapping.Credit); err != nil {
+			return columns, fmt.Errorf("credit column error: %w", err)
+		}
+	}
+	if mapping.Type != "" {
+		if columns.kind, err = utils.GetColumnIndex(headers, mapping.Type); err != nil {
+			return columns, fmt.Errorf("type column error: %w", err)
+		}
+	}
+
+	return columns, nil
+}
+
+// parseRowAmount builds a signed amount from the mapped columns and applies the amount multiplier.
+// Debits are always negative and credits positive, whatever sign the bank wrote them with
+func parseRowAmount(row []string, columns amountColumns, format *types.ImportFormat) (float64, error) {
+	var amount float64
+	found := false
+
+	if columns.amount >= 0 {
+		if amountStr := strings.TrimSpace(row[columns.amount]); amountStr != "" {
+			value, err := ParseMoney(amountStr, format.MoneyFormat)
+			if err != nil {
+				return 0, err
+			}
+			amount, found = value, true
+		}
+	}
+
+	if !found {
+		if columns.debit >= 0 {
+			if debitStr := strings.TrimSpace(row[columns.debit]); debitStr != "" {
+				value, err := ParseMoney(debitStr, format.MoneyFormat)
+				if err != nil {
+					return 0, fmt.Errorf("debit: %w", err)
+				}
+				amount -= math.Abs(value)
+				found = true
+			}
+		}
+		if columns.credit >= 0 {
+			if creditStr := strings.TrimSpace(row[columns.credit]); creditStr != "" {
+				value, err := ParseMoney(creditStr, format.MoneyFormat)
+				if err != nil {
+					return 0, fmt.Errorf("credit: %w", err)
+				}
+				amount += math.Abs(value)
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("no amount in row")
+	}
+
+	// A type column decides the sign on its own
+	if columns.kind >= 0 {
+		kind := strings.TrimSpace(row[columns.kind])
+		switch {
+		case matchesTypeValue(kind, format.DebitTypeValues, defaultDebitTypeValues):
+			amount = -math.Abs(amount)
+		case matchesTypeValue(kind, format.CreditTypeValues, defaultCreditTypeValues):
+			amount = math.Abs(amount)
+		default:
+			return 0, fmt.Errorf("unknown transaction type '%s'", kind)
+		}
+	}
+
+	// Apply amount multiplier
+	return amount * format.AmountMultiplier, nil
+}
+
+var (
+	defaultDebitTypeValues  = []string{"DR", "DEBIT", "D"}
+	defaultCreditTypeValues = []string{"CR", "CREDIT", "C"}
+)
+
+// matchesTypeValue checks a type cell against the configured values, or the defaults if none are configured
+func matchesTypeValue(value string, configured []string, defaults []string) bool {
+	values := configured
+	if len(values) == 0 {
+		values = defaults
+	}
+	for _, v := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
 }
 
 // isBlacklisted checks if a transaction should be filtered out
@@ -0,0 +1,262 @@
+package dataparse
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// expected is the part of a parsed transaction the parser tests compare
+type expected struct {
+	date        string
+	description string
+	amount      float64
+	externalID  string
+	category    string
+}
+
+// testFile returns the path of a sample file in testdata
+func testFile(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+// checkTransactions compares parsed transactions with the expected ones. Daily sequencing doesn't
+// keep the file order, so both are compared sorted by date and description
+func checkTransactions(t *testing.T, got []types.GenericTransaction, want []expected) {
+	t.Helper()
+
+	slices.SortFunc(got, func(a, b types.GenericTransaction) int {
+		if c := a.Date.Compare(b.Date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Description, b.Description)
+	})
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d transactions, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if date := g.Date.Format("2006-01-02"); date != w.date {
+			t.Errorf("transaction %d: date %s, want %s", i, date, w.date)
+		}
+		if g.Description != w.description {
+			t.Errorf("transaction %d: description %q, want %q", i, g.Description, w.description)
+		}
+		if g.Amount != w.amount {
+			t.Errorf("transaction %d: amount %v, want %v", i, g.Amount, w.amount)
+		}
+		if g.ExternalID != w.externalID {
+			t.Errorf("transaction %d: external ID %q, want %q", i, g.ExternalID, w.externalID)
+		}
+		if g.Category != w.category {
+			t.Errorf("transaction %d: category %q, want %q", i, g.Category, w.category)
+		}
+	}
+}
+
+// checkSkipped compares the reasons rows were skipped for
+func checkSkipped(t *testing.T, got []types.SkippedRow, want []string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d skipped rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if !strings.Contains(got[i].Reason, w) {
+			t.Errorf("skipped row %d: reason %q, want it to contain %q", i, got[i].Reason, w)
+		}
+	}
+}
+
+func TestParseGenericCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		format  types.ImportFormat
+		want    []expected
+		skipped []string
+	}{
+		{
+			name: "debit and credit columns with a template and footer",
+			file: "debit_credit.csv",
+			format: types.ImportFormat{
+				ColumnMapping: types.ColumnMapping{
+					Date:                "Date",
+					DescriptionTemplate: "{Payee} - {Memo}",
+					Debit:               "Debit",
+					Credit:              "Credit",
+					Balance:             "Balance",
+					Metadata:            map[string]string{"check_number": "Check"},
+				},
+				DateFormat:       "02.01.2006",
+				AmountMultiplier: 1,
+				Delimiter:        ";",
+				SkipLines:        3,
+				FooterMarkers:    []string{"total"},
+				MoneyFormat:      types.MoneyFormat{DecimalSeparator: ",", ParenthesesNegative: true},
+			},
+			want: []expected{
+				{date: "2024-04-03", description: "Supermarkt - Wocheneinkauf", amount: -1234.5},
+				{date: "2024-04-04", description: "Gehalt", amount: 2500},
+				{date: "2024-04-05", description: "Apotheke - Rezept", amount: -12},
+			},
+			skipped: []string{"no amount in row", "invalid date format"},
+		},
+		{
+			name: "type column decides the sign",
+			file: "typed.csv",
+			format: types.ImportFormat{
+				ColumnMapping:     types.ColumnMapping{Date: "Posted", Description: "Description", Amount: "Amount", Type: "Type"},
+				DateFormat:        "2006-01-02",
+				AmountMultiplier:  1,
+				BlacklistContains: []string{"IGNORED"},
+			},
+			want: []expected{
+				{date: "2024-05-01", description: "RENT", amount: -1200},
+				{date: "2024-05-02", description: "REFUND", amount: 15},
+			},
+			skipped: []string{"blacklisted", "unknown transaction type"},
+		},
+		{
+			name: "amount multiplier",
+			file: "typed.csv",
+			format: types.ImportFormat{
+				ColumnMapping:    types.ColumnMapping{Date: "Posted", Description: "Description", Amount: "Amount"},
+				DateFormat:       "2006-01-02",
+				AmountMultiplier: -1,
+				BlacklistExact:   []string{"ODD", "IGNORED FEE"},
+			},
+			want: []expected{
+				{date: "2024-05-01", description: "RENT", amount: -1200},
+				{date: "2024-05-02", description: "REFUND", amount: 15},
+			},
+			skipped: []string{"blacklisted", "blacklisted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, skipped, err := ParseGenericCSV(testFile(tt.file), &tt.format)
+			if err != nil {
+				t.Fatalf("ParseGenericCSV: %v", err)
+			}
+			checkTransactions(t, transactions, tt.want)
+			checkSkipped(t, skipped, tt.skipped)
+		})
+	}
+}
+
+func TestParseGenericCSVBalanceAndMetadata(t *testing.T) {
+	format := types.ImportFormat{
+		ColumnMapping: types.ColumnMapping{
+			Date:        "Date",
+			Description: "Payee",
+			Debit:       "Debit",
+			Credit:      "Credit",
+			Balance:     "Balance",
+			Metadata:    map[string]string{"check_number": "Check", "memo": "Memo"},
+		},
+		DateFormat:       "02.01.2006",
+		AmountMultiplier: 1,
+		Delimiter:        ";",
+		SkipLines:        3,
+		FooterMarkers:    []string{"Total"},
+		MoneyFormat:      types.MoneyFormat{DecimalSeparator: ",", ParenthesesNegative: true},
+	}
+
+	transactions, _, err := ParseGenericCSV(testFile("debit_credit.csv"), &format)
+	if err != nil {
+		t.Fatalf("ParseGenericCSV: %v", err)
+	}
+
+	byPayee := make(map[string]types.GenericTransaction)
+	for _, tx := range transactions {
+		byPayee[tx.Description] = tx
+	}
+
+	pharmacy := byPayee["Apotheke"]
+	if pharmacy.Balance == nil || *pharmacy.Balance != 11253.5 {
+		t.Errorf("balance %v, want 11253.5", pharmacy.Balance)
+	}
+	if want := map[string]string{"check_number": "1042", "memo": "Rezept"}; !maps.Equal(pharmacy.Metadata, want) {
+		t.Errorf("metadata %v, want %v", pharmacy.Metadata, want)
+	}
+	if salary := byPayee["Gehalt"]; len(salary.Metadata) != 0 {
+		t.Errorf("empty metadata columns should be left out, got %v", salary.Metadata)
+	}
+}
+
+func TestParseGenericCSVMissingColumn(t *testing.T) {
+	format := types.ImportFormat{
+		ColumnMapping:    types.ColumnMapping{Date: "Posted", Description: "Description", Amount: "Value"},
+		DateFormat:       "2006-01-02",
+		AmountMultiplier: 1,
+	}
+
+	_, _, err := ParseGenericCSV(testFile("typed.csv"), &format)
+	if err == nil || !strings.Contains(err.Error(), "amount column error") {
+		t.Fatalf("got error %v, want an amount column error", err)
+	}
+}
+
+func TestDescriptionTemplate(t *testing.T) {
+	headers := []string{"Payee", "Memo", "Reference"}
+	tests := []struct {
+		template string
+		row      []string
+		want     string
+	}{
+		{"{Payee} - {Memo}", []string{"SHOP", "GIFT", ""}, "SHOP - GIFT"},
+		{"{Payee} - {Memo}", []string{"SHOP", " ", ""}, "SHOP"},
+		{"{Payee} - {Memo}", []string{"", "GIFT", ""}, "GIFT"},
+		{"Ref {Reference}: {Payee}", []string{"SHOP", "", "R1"}, "Ref R1: SHOP"},
+		{"{Payee} - {Memo}", []string{"", "", ""}, ""},
+		{"{Payee} / {Memo}", []string{"SHOP"}, "SHOP"},
+	}
+
+	for _, tt := range tests {
+		template, err := newDescriptionTemplate(headers, tt.template)
+		if err != nil {
+			t.Fatalf("newDescriptionTemplate(%q): %v", tt.template, err)
+		}
+		if got := template.build(tt.row); got != tt.want {
+			t.Errorf("%q with %q: got %q, want %q", tt.template, tt.row, got, tt.want)
+		}
+	}
+
+	if _, err := newDescriptionTemplate(headers, "{Missing}"); err == nil {
+		t.Error("expected an error for a template naming an unknown column")
+	}
+	if _, err := newDescriptionTemplate(headers, "no columns"); err == nil {
+		t.Error("expected an error for a template without columns")
+	}
+}
+
+func TestProcessGenericTransactionsWithDailySequence(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	transactions := ProcessGenericTransactionsWithDailySequence([]types.GenericTransaction{
+		{Date: day, Description: "COFFEE", Amount: -3},
+		{Date: day, Description: "COFFEE", Amount: -3},
+		{Date: day, Description: "COFFEE", Amount: -4},
+		{Date: day.AddDate(0, 0, 1), Description: "COFFEE", Amount: -3},
+	})
+
+	var sequences []int
+	for _, tx := range transactions {
+		if tx.Amount == -3 && tx.Date.Equal(day) {
+			sequences = append(sequences, tx.DailySequence)
+		} else if tx.DailySequence != 1 {
+			t.Errorf("%s %v: sequence %d, want 1", tx.Date.Format("2006-01-02"), tx.Amount, tx.DailySequence)
+		}
+	}
+	slices.Sort(sequences)
+	if !slices.Equal(sequences, []int{1, 2}) {
+		t.Errorf("identical transactions got sequences %v, want [1 2]", sequences)
+	}
+}
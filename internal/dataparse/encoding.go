@@ -0,0 +1,40 @@
+package dataparse
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252High maps bytes 0x80-0x9F to the characters Windows-1252 puts there.
+// The rest of Windows-1252 matches ISO-8859-1, which maps every byte to the same code point
+var windows1252High = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+// decodeText converts file contents in the given encoding to a UTF-8 string and strips any byte order mark
+func decodeText(data []byte, encoding string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(encoding, "_", "-")) {
+	case "", "utf-8", "utf8", "utf-8-bom":
+		return strings.TrimPrefix(string(data), "\ufeff"), nil
+	case "windows-1252", "cp1252":
+		var b strings.Builder
+		for _, c := range data {
+			if c >= 0x80 && c <= 0x9F {
+				b.WriteRune(windows1252High[c-0x80])
+			} else {
+				b.WriteRune(rune(c))
+			}
+		}
+		return b.String(), nil
+	case "iso-8859-1", "latin1", "latin-1":
+		var b strings.Builder
+		for _, c := range data {
+			b.WriteRune(rune(c))
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding '%s'", encoding)
+	}
+}
@@ -0,0 +1,89 @@
+package dataparse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// defaultCurrencySymbols are always stripped from money values
+var defaultCurrencySymbols = []string{"$", "€", "£", "¥", "USD", "EUR", "GBP", "CAD", "AUD", "CHF"}
+
+// ParseMoney parses a money cell such as "$1,234.56", "(45.00)", "1.234,56 €" or "-  12.00"
+// using the separators and sign conventions configured for the import format
+func ParseMoney(value string, moneyFormat types.MoneyFormat) (float64, error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	// Strip currency symbols, configured ones first so a symbol like "US$" is removed before "$"
+	symbols := append(append([]string{}, moneyFormat.CurrencySymbols...), defaultCurrencySymbols...)
+	for _, symbol := range symbols {
+		if symbol != "" {
+			s = strings.ReplaceAll(s, symbol, "")
+		}
+	}
+
+	// Whitespace, including non-breaking spaces used as thousands separators, carries no meaning
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	// Checked once symbols and spacing are gone, so "$(45.00)" and "(45.00) €" are negative too
+	negative := false
+	if moneyFormat.ParenthesesNegative && strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+
+	if moneyFormat.TrailingMinus && strings.HasSuffix(s, "-") {
+		negative = true
+		s = strings.TrimSuffix(s, "-")
+	}
+
+	decimalSeparator, thousandsSeparator := moneySeparators(moneyFormat)
+	if thousandsSeparator != "" {
+		s = strings.ReplaceAll(s, thousandsSeparator, "")
+	}
+	if decimalSeparator != "." {
+		s = strings.ReplaceAll(s, decimalSeparator, ".")
+	}
+
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid money value '%s'", value)
+	}
+
+	if negative {
+		amount = -math.Abs(amount)
+	}
+	return amount, nil
+}
+
+// moneySeparators returns the decimal and thousands separators, defaulting to "." and ",".
+// When only the decimal separator is set to "," the thousands separator defaults to "."
+func moneySeparators(moneyFormat types.MoneyFormat) (string, string) {
+	decimalSeparator := moneyFormat.DecimalSeparator
+	if decimalSeparator == "" {
+		decimalSeparator = "."
+	}
+
+	thousandsSeparator := moneyFormat.ThousandsSeparator
+	if thousandsSeparator == "" {
+		if decimalSeparator == "," {
+			thousandsSeparator = "."
+		} else {
+			thousandsSeparator = ","
+		}
+	}
+
+	return decimalSeparator, thousandsSeparator
+}
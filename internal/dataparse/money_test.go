@@ -0,0 +1,55 @@
+package dataparse
+
+import (
+	"testing"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+func TestParseMoney(t *testing.T) {
+	european := types.MoneyFormat{DecimalSeparator: ","}
+	accounting := types.MoneyFormat{ParenthesesNegative: true}
+
+	tests := []struct {
+		name    string
+		value   string
+		format  types.MoneyFormat
+		want    float64
+		wantErr bool
+	}{
+		{"plain", "12.34", types.MoneyFormat{}, 12.34, false},
+		{"currency and thousands", "$1,234.56", types.MoneyFormat{}, 1234.56, false},
+		{"spaced minus", "-  12.00", types.MoneyFormat{}, -12, false},
+		{"currency code", "USD 99.95", types.MoneyFormat{}, 99.95, false},
+		{"european", "1.234,56 €", european, 1234.56, false},
+		{"non-breaking space thousands", "1 234,56", european, 1234.56, false},
+		{"explicit separators", "1'234.50", types.MoneyFormat{ThousandsSeparator: "'"}, 1234.5, false},
+		{"configured symbol", "US$5.00", types.MoneyFormat{CurrencySymbols: []string{"US$"}}, 5, false},
+		{"parentheses", "(45.00)", accounting, -45, false},
+		{"parentheses inside symbol", "$(45.00)", accounting, -45, false},
+		{"parentheses with trailing symbol", "(45,00) €", types.MoneyFormat{DecimalSeparator: ",", ParenthesesNegative: true}, -45, false},
+		{"parentheses not enabled", "(45.00)", types.MoneyFormat{}, 0, true},
+		{"trailing minus", "45.00-", types.MoneyFormat{TrailingMinus: true}, -45, false},
+		{"trailing minus not enabled", "45.00-", types.MoneyFormat{}, 0, true},
+		{"empty", "  ", types.MoneyFormat{}, 0, true},
+		{"text", "n/a", types.MoneyFormat{}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.value, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMoney(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q): %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
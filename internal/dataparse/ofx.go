@@ -0,0 +1,215 @@
+package dataparse
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// ofxToken is a single tag found in an OFX document along with the text that follows it
+type ofxToken struct {
+	name    string
+	closing bool
+	text    string
+}
+
+// ofxTransaction holds the raw STMTTRN fields before they are converted
+type ofxTransaction struct {
+	datePosted string
+	amount     string
+	fitID      string
+	name       string
+	memo       string
+}
+
+// ParseOFX parses an OFX or QFX statement (SGML 1.x or XML 2.x) into a statement.
+// Amounts are already signed in OFX so no amount multiplier is applied
+func ParseOFX(filePath string) (*types.ParsedStatement, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	tokens, err := tokenizeOFX(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &types.ParsedStatement{}
+	var current *ofxTransaction
+	inLedgerBalance := false
+	var balanceAmount, balanceDate string
+
+	for _, token := range tokens {
+		if token.closing {
+			switch token.name {
+			case "STMTTRN":
+				if current != nil {
+					if transaction, err := convertOFXTransaction(current); err != nil {
+						statement.Skipped = skipRow(statement.Skipped, "transaction "+current.fitID, current.description(), err.Error())
+					} else {
+						statement.Transactions = append(statement.Transactions, transaction)
+					}
+				}
+				current = nil
+			case "LEDGERBAL":
+				inLedgerBalance = false
+			}
+			continue
+		}
+
+		switch token.name {
+		case "STMTTRN":
+			current = &ofxTransaction{}
+			continue
+		case "LEDGERBAL":
+			inLedgerBalance = true
+			continue
+		}
+
+		if token.text == "" {
+			continue
+		}
+
+		switch {
+		case current != nil:
+			switch token.name {
+			case "DTPOSTED":
+				current.datePosted = token.text
+			case "TRNAMT":
+				current.amount = token.text
+			case "FITID":
+				current.fitID = token.text
+			case "NAME":
+				current.name = token.text
+			case "MEMO":
+				current.memo = token.text
+			}
+		case inLedgerBalance:
+			switch token.name {
+			case "BALAMT":
+				balanceAmount = token.text
+			case "DTASOF":
+				balanceDate = token.text
+			}
+		case token.name == "ACCTID" && statement.AccountID == "":
+			statement.AccountID = token.text
+		}
+	}
+
+	// Record the ledger balance if the statement has one
+	if balanceAmount != "" {
+		balance, err := parseOFXAmount(balanceAmount)
+		if err != nil {
+			fmt.Printf("Skipping ledger balance: invalid amount: %v\n", err)
+		} else {
+			date, err := parseOFXDate(balanceDate)
+			if err != nil {
+				fmt.Printf("Skipping ledger balance: invalid date: %v\n", err)
+			} else {
+				statement.ClosingBalance = &balance
+				statement.BalanceDate = date
+			}
+		}
+	}
+
+	// Sequences are only used for transactions without a FITID
+	statement.Transactions = ProcessGenericTransactionsWithDailySequence(statement.Transactions)
+
+	return statement, nil
+}
+
+// tokenizeOFX splits the OFX body into tags, skipping the SGML header or XML declarations
+func tokenizeOFX(content string) ([]ofxToken, error) {
+	start := strings.Index(strings.ToUpper(content), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("file does not contain an <OFX> element")
+	}
+	content = content[start:]
+
+	var tokens []ofxToken
+	for {
+		open := strings.Index(content, "<")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(content[open:], ">")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated tag in OFX file")
+		}
+		tag := content[open+1 : open+end]
+		content = content[open+end+1:]
+
+		// Skip processing instructions and comments
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		// Text runs until the next tag
+		text := content
+		if next := strings.Index(content, "<"); next >= 0 {
+			text = content[:next]
+		}
+
+		token := ofxToken{text: html.UnescapeString(strings.TrimSpace(text))}
+		if strings.HasPrefix(tag, "/") {
+			token.closing = true
+			tag = tag[1:]
+		}
+		token.name = strings.ToUpper(strings.TrimSpace(tag))
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// convertOFXTransaction turns the raw STMTTRN fields into a generic transaction
+func convertOFXTransaction(raw *ofxTransaction) (types.GenericTransaction, error) {
+	date, err := parseOFXDate(raw.datePosted)
+	if err != nil {
+		return types.GenericTransaction{}, fmt.Errorf("invalid date format: %w", err)
+	}
+
+	amount, err := parseOFXAmount(raw.amount)
+	if err != nil {
+		return types.GenericTransaction{}, fmt.Errorf("invalid amount: %w", err)
+	}
+
+	return types.GenericTransaction{
+		Date:        date,
+		Description: raw.description(),
+		Amount:      amount,
+		ExternalID:  raw.fitID,
+	}, nil
+}
+
+// description returns the payee name, falling back to the memo
+func (raw *ofxTransaction) description() string {
+	if raw.name != "" {
+		return raw.name
+	}
+	return raw.memo
+}
+
+// parseOFXDate parses the date portion of an OFX datetime (YYYYMMDD[HHMMSS[.XXX]][[TZ]])
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("date '%s' is too short", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+// parseOFXAmount parses an OFX amount, accepting a comma as the decimal separator
+func parseOFXAmount(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	}
+	return amount, nil
+}
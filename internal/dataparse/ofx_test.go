@@ -0,0 +1,97 @@
+package dataparse
+
+import "testing"
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		accountID string
+		balance   *float64
+		want      []expected
+		skipped   []string
+	}{
+		{
+			name:      "SGML",
+			file:      "statement.ofx",
+			accountID: "123456789",
+			balance:   ptr(2001.25),
+			want: []expected{
+				{date: "2024-01-15", description: "COFFEE & CO", amount: -42.5, externalID: "FIT001"},
+				{date: "2024-01-16", description: "PAYROLL", amount: 1500, externalID: "FIT002"},
+			},
+			skipped: []string{"invalid date format"},
+		},
+		{
+			name:      "XML",
+			file:      "statement.qfx",
+			accountID: "4111222233334444",
+			want: []expected{
+				{date: "2024-03-02", description: "STREAMING SERVICE", amount: -19.99, externalID: "CC100"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := ParseOFX(testFile(tt.file))
+			if err != nil {
+				t.Fatalf("ParseOFX: %v", err)
+			}
+			if statement.AccountID != tt.accountID {
+				t.Errorf("account ID %q, want %q", statement.AccountID, tt.accountID)
+			}
+			checkBalance(t, statement.ClosingBalance, tt.balance)
+			checkTransactions(t, statement.Transactions, tt.want)
+			checkSkipped(t, statement.Skipped, tt.skipped)
+		})
+	}
+}
+
+func TestParseOFXDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"20240115", "2024-01-15", false},
+		{"20240115120000", "2024-01-15", false},
+		{"20240115120000.000[-5:EST]", "2024-01-15", false},
+		{"202401", "", true},
+		{"2024AB15", "", true},
+	}
+
+	for _, tt := range tests {
+		date, err := parseOFXDate(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseOFXDate(%q) = %v, want an error", tt.value, date)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseOFXDate(%q): %v", tt.value, err)
+		} else if got := date.Format("2006-01-02"); got != tt.want {
+			t.Errorf("parseOFXDate(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+// checkBalance compares a statement's closing balance
+func checkBalance(t *testing.T, got *float64, want *float64) {
+	t.Helper()
+
+	switch {
+	case want == nil && got != nil:
+		t.Errorf("closing balance %v, want none", *got)
+	case want != nil && got == nil:
+		t.Errorf("no closing balance, want %v", *want)
+	case want != nil && *got != *want:
+		t.Errorf("closing balance %v, want %v", *got, *want)
+	}
+}
+
+// ptr returns a pointer for an expected balance
+func ptr(value float64) *float64 {
+	return &value
+}
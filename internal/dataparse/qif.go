@@ -0,0 +1,222 @@
+package dataparse
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// qifDateFormats are the date layouts commonly written by Quicken, Money and GnuCash
+var qifDateFormats = []string{
+	"1/2/2006",
+	"1/2/06",
+	"2006-01-02",
+	"2.1.2006",
+	"2.1.06",
+}
+
+// qifSplit is a single S/$ pair inside a QIF record
+type qifSplit struct {
+	category string
+	memo     string
+	amount   string
+}
+
+// qifRecord holds the raw fields of a single QIF transaction
+type qifRecord struct {
+	date     string
+	amount   string
+	payee    string
+	memo     string
+	category string
+	splits   []qifSplit
+}
+
+// ParseQIF parses a QIF file using the provided import format configuration.
+// Only bank, cash and credit card sections are read. Split records become one
+// transaction per split so each part can be categorized on its own
+func ParseQIF(filePath string, format *types.ImportFormat) ([]types.GenericTransaction, []types.SkippedRow, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	var rawTransactions []types.GenericTransaction
+	var skipped []types.SkippedRow
+	var current qifRecord
+	inTransactions := false
+	recordNum := 0
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Section headers
+		if strings.HasPrefix(line, "!") {
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(header, "!type:bank"), strings.HasPrefix(header, "!type:ccard"), strings.HasPrefix(header, "!type:cash"):
+				inTransactions = true
+			case strings.HasPrefix(header, "!type:"):
+				fmt.Printf("Skipping unsupported QIF section: %s\n", strings.TrimSpace(line))
+				inTransactions = false
+			}
+			current = qifRecord{}
+			continue
+		}
+
+		if !inTransactions {
+			continue
+		}
+
+		code, value := line[0], strings.TrimSpace(line[1:])
+		switch code {
+		case 'D':
+			current.date = value
+		case 'T':
+			current.amount = value
+		case 'P':
+			current.payee = value
+		case 'M':
+			current.memo = value
+		case 'L':
+			current.category = value
+		case 'S':
+			current.splits = append(current.splits, qifSplit{category: value})
+		case 'E':
+			if len(current.splits) > 0 {
+				current.splits[len(current.splits)-1].memo = value
+			}
+		case '$':
+			if len(current.splits) > 0 {
+				current.splits[len(current.splits)-1].amount = value
+			}
+		case '^':
+			recordNum++
+			recordLabel := fmt.Sprintf("record %d", recordNum)
+
+			// Apply blacklist filters
+			if isBlacklisted(current.description(), 0, format) {
+				skipped = skipBlacklisted(skipped, recordLabel, current.description())
+			} else if transactions, err := convertQIFRecord(current, format); err != nil {
+				skipped = skipRow(skipped, recordLabel, current.description(), err.Error())
+			} else {
+				rawTransactions = append(rawTransactions, transactions...)
+			}
+			current = qifRecord{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading QIF: %w", err)
+	}
+
+	// Process transactions to assign daily sequences
+	return ProcessGenericTransactionsWithDailySequence(rawTransactions), skipped, nil
+}
+
+// convertQIFRecord converts a raw record into one transaction, or one per split
+func convertQIFRecord(record qifRecord, format *types.ImportFormat) ([]types.GenericTransaction, error) {
+	date, err := parseQIFDate(record.date, format.DateFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date format: %w", err)
+	}
+
+	description := record.description()
+
+	if len(record.splits) == 0 {
+		amount, err := parseQIFAmount(record.amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount: %w", err)
+		}
+		return []types.GenericTransaction{{
+			Date:        date,
+			Description: description,
+			Amount:      amount,
+			Category:    qifCategory(record.category),
+		}}, nil
+	}
+
+	var transactions []types.GenericTransaction
+	for _, split := range record.splits {
+		amount, err := parseQIFAmount(split.amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid split amount: %w", err)
+		}
+
+		// Match the split description format used by the spl command
+		splitDescription := description
+		if split.memo != "" {
+			splitDescription = description + " - " + split.memo
+		}
+
+		transactions = append(transactions, types.GenericTransaction{
+			Date:        date,
+			Description: splitDescription,
+			Amount:      amount,
+			Category:    qifCategory(split.category),
+		})
+	}
+
+	return transactions, nil
+}
+
+// description returns the payee, falling back to the memo
+func (r qifRecord) description() string {
+	if r.payee != "" {
+		return r.payee
+	}
+	return r.memo
+}
+
+// parseQIFDate parses a QIF date with the configured layout, falling back to common QIF layouts.
+// Quicken writes years after 2000 with an apostrophe (1/15'24) and pads single digits with spaces,
+// including the year (1/ 5' 4)
+func parseQIFDate(value string, dateFormat string) (time.Time, error) {
+	normalized := value
+	if idx := strings.LastIndex(value, "'"); idx >= 0 {
+		year := strings.TrimSpace(value[idx+1:])
+		if len(year) == 1 {
+			year = "0" + year
+		}
+		normalized = value[:idx] + "/" + year
+	}
+	normalized = strings.ReplaceAll(normalized, " ", "")
+
+	if dateFormat != "" {
+		return time.Parse(dateFormat, normalized)
+	}
+
+	for _, layout := range qifDateFormats {
+		if date, err := time.Parse(layout, normalized); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date '%s'", value)
+}
+
+// parseQIFAmount parses a QIF amount, ignoring thousands separators
+func parseQIFAmount(value string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(value), ",", ""), 64)
+}
+
+// qifCategory returns the FortiFi category name for a QIF L/S value.
+// Transfers ([Account]) carry no category and classes (Category/Class) are dropped
+func qifCategory(value string) string {
+	if strings.HasPrefix(value, "[") {
+		return ""
+	}
+	if idx := strings.Index(value, "/"); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,102 @@
+package dataparse
+
+import (
+	"testing"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+func TestParseQIF(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  types.ImportFormat
+		want    []expected
+		skipped []string
+	}{
+		{
+			name: "default date layouts",
+			want: []expected{
+				{date: "2004-01-05", description: "EMPLOYER INC", amount: 1500, category: "Income"},
+				{date: "2024-01-15", description: "COFFEE SHOP", amount: -42.5, category: "Dining"},
+				{date: "2024-02-01", description: "GROCERY MART", amount: -40, category: "Household"},
+				{date: "2024-02-01", description: "GROCERY MART - Food", amount: -60, category: "Groceries"},
+				{date: "2024-02-03", description: "TRANSFER OUT", amount: -250},
+			},
+			skipped: []string{"invalid date format"},
+		},
+		{
+			name:   "blacklist",
+			format: types.ImportFormat{BlacklistExact: []string{"TRANSFER OUT"}, BlacklistContains: []string{"EMPLOYER"}},
+			want: []expected{
+				{date: "2024-01-15", description: "COFFEE SHOP", amount: -42.5, category: "Dining"},
+				{date: "2024-02-01", description: "GROCERY MART", amount: -40, category: "Household"},
+				{date: "2024-02-01", description: "GROCERY MART - Food", amount: -60, category: "Groceries"},
+			},
+			skipped: []string{"blacklisted", "blacklisted", "invalid date format"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, skipped, err := ParseQIF(testFile("statement.qif"), &tt.format)
+			if err != nil {
+				t.Fatalf("ParseQIF: %v", err)
+			}
+			checkTransactions(t, transactions, tt.want)
+			checkSkipped(t, skipped, tt.skipped)
+		})
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		value      string
+		dateFormat string
+		want       string
+		wantErr    bool
+	}{
+		{"1/15/2024", "", "2024-01-15", false},
+		{"1/15/24", "", "2024-01-15", false},
+		{"1/15'24", "", "2024-01-15", false},
+		{" 1/ 5'24", "", "2024-01-05", false},
+		{"1/ 5' 4", "", "2004-01-05", false},
+		{"2024-01-15", "", "2024-01-15", false},
+		{"15.1.2024", "", "2024-01-15", false},
+		{"15/01/2024", "02/01/2006", "2024-01-15", false},
+		{"15/01'24", "02/01/06", "2024-01-15", false},
+		{"13/45/2024", "", "", true},
+		{"yesterday", "", "", true},
+	}
+
+	for _, tt := range tests {
+		date, err := parseQIFDate(tt.value, tt.dateFormat)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseQIFDate(%q) = %v, want an error", tt.value, date)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQIFDate(%q, %q): %v", tt.value, tt.dateFormat, err)
+		} else if got := date.Format("2006-01-02"); got != tt.want {
+			t.Errorf("parseQIFDate(%q, %q) = %s, want %s", tt.value, tt.dateFormat, got, tt.want)
+		}
+	}
+}
+
+func TestQIFCategory(t *testing.T) {
+	tests := map[string]string{
+		"Groceries":          "Groceries",
+		"Dining/Personal":    "Dining",
+		" Auto:Fuel ":        "Auto:Fuel",
+		"[Savings]":          "",
+		"":                   "",
+		"Bills/Utilities/UK": "Bills",
+	}
+
+	for value, want := range tests {
+		if got := qifCategory(value); got != want {
+			t.Errorf("qifCategory(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package classifier
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/database"
+	txnUtils "github.com/HadeZForge/FortiFi/internal/transaction/utils"
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// SuggestionCount is how many categories are suggested for a transaction
+const SuggestionCount = 3
+
+// amountBuckets are the upper bounds used to turn an amount's size into a feature
+var amountBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+// Model is a naive Bayes classifier over description words, amount size and account, trained from the
+// categorized transactions in the database. It never leaves the machine
+type Model struct {
+	categories map[int]*categoryCounts
+	examples   int
+	vocabulary map[string]bool
+}
+
+// categoryCounts is what the model learned about one category
+type categoryCounts struct {
+	name     string
+	examples int
+	features map[string]int
+	total    int
+}
+
+// example is a transaction the model learns from
+type example struct {
+	categoryID int
+	features   string
+}
+
+// Load brings the stored model up to date with the transactions' current categories and reads it.
+// Only transactions that were added, recategorized, renamed or deleted since the last load are learned
+// or unlearned. Runs in its own transaction when given a database
+func Load(db database.DBTX) (*Model, error) {
+	if sqlDB, ok := db.(*sql.DB); ok {
+		tx, err := sqlDB.Begin()
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		model, err := Load(tx)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit classifier: %w", err)
+		}
+		return model, nil
+	}
+
+	if err := sync(db); err != nil {
+		return nil, err
+	}
+	return read(db)
+}
+
+// Update brings the stored model and this loaded copy up to date with the current category of the
+// given transactions, so each change is learned without resyncing every transaction. Runs in its own
+// transaction when given a database
+func (m *Model) Update(db database.DBTX, transactionIDs ...string) error {
+	if m == nil {
+		return nil
+	}
+	if sqlDB, ok := db.(*sql.DB); ok {
+		tx, err := sqlDB.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := m.Update(tx, transactionIDs...); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit classifier: %w", err)
+		}
+		return nil
+	}
+
+	for _, id := range transactionIDs {
+		old, learned, err := readExample(db, id)
+		if err != nil {
+			return err
+		}
+		now, name, current, err := currentExample(db, id)
+		if err != nil {
+			return err
+		}
+
+		if learned && (!current || now != old) {
+			if err := unlearn(db, id, old); err != nil {
+				return err
+			}
+			m.forget(old)
+		}
+		if current && (!learned || now != old) {
+			if err := learn(db, id, now); err != nil {
+				return err
+			}
+			m.add(now, name)
+		}
+	}
+
+	if _, err := db.Exec(`DELETE FROM classifier_counts WHERE count <= 0`); err != nil {
+		return fmt.Errorf("failed to clean up classifier: %w", err)
+	}
+	return nil
+}
+
+// Features describes a transaction the way the model sees it: each payee word, the size and direction
+// of the amount, and the account
+func Features(accountID int, amount float64, description string) []string {
+	var features []string
+	for _, word := range strings.Fields(txnUtils.NormalizeDescription(description)) {
+		feature := "word:" + word
+		if !slices.Contains(features, feature) {
+			features = append(features, feature)
+		}
+	}
+
+	direction := "out"
+	if amount > 0 {
+		direction = "in"
+	}
+	bucket := "more"
+	for _, limit := range amountBuckets {
+		if math.Abs(amount) < limit {
+			bucket = "<" + strconv.FormatFloat(limit, 'f', -1, 64)
+			break
+		}
+	}
+	features = append(features, "amount:"+direction+bucket)
+
+	return append(features, "account:"+strconv.Itoa(accountID))
+}
+
+// Suggest returns the categories that fit a transaction best, most likely first, with confidences that
+// add up to 1 over every category. Returns nothing until the model has learned from some transactions
+func (m *Model) Suggest(accountID int, amount float64, description string, limit int) []types.CategorySuggestion {
+	if m == nil || m.examples == 0 {
+		return nil
+	}
+
+	features := Features(accountID, amount, description)
+	suggestions := make([]types.CategorySuggestion, 0, len(m.categories))
+	scores := make([]float64, 0, len(m.categories))
+	best := math.Inf(-1)
+	for id, counts := range m.categories {
+		// Laplace smoothing keeps unseen features from ruling a category out
+		score := math.Log(float64(counts.examples+1) / float64(m.examples+len(m.categories)))
+		for _, feature := range features {
+			if !m.vocabulary[feature] {
+				continue
+			}
+			score += math.Log(float64(counts.features[feature]+1) / float64(counts.total+len(m.vocabulary)))
+		}
+		suggestions = append(suggestions, types.CategorySuggestion{CategoryID: id, CategoryName: counts.name})
+		scores = append(scores, score)
+		best = max(best, score)
+	}
+
+	// Turn log scores into probabilities
+	sum := 0.0
+	for i, score := range scores {
+		scores[i] = math.Exp(score - best)
+		sum += scores[i]
+	}
+	for i := range suggestions {
+		suggestions[i].Confidence = scores[i] / sum
+	}
+
+	slices.SortFunc(suggestions, func(a, b types.CategorySuggestion) int {
+		if a.Confidence != b.Confidence {
+			if a.Confidence > b.Confidence {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.CategoryName, b.CategoryName)
+	})
+	return suggestions[:min(limit, len(suggestions))]
+}
+
+// FormatSuggestions lists suggestions with their confidence, e.g. "Groceries 72%, Dining 20%"
+func FormatSuggestions(suggestions []types.CategorySuggestion) string {
+	parts := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		parts[i] = fmt.Sprintf("%s %.0f%%", suggestion.CategoryName, suggestion.Confidence*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sync learns the transactions whose category or description changed since they were last learned and
+// unlearns the ones that were deleted or moved back to Uncategorized. Transactions are learned from the
+// description they were imported with, which is what new imports are suggested from
+func sync(db database.DBTX) error {
+	learned, err := readExamples(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.account_id, t.category_id, t.amount, COALESCE(t.raw_description, t.description, '')
+		FROM transactions t
+		JOIN categories c ON c.id = t.category_id
+		WHERE LOWER(c.name) != 'uncategorized'`)
+	if err != nil {
+		return fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	current := make(map[string]example)
+	for rows.Next() {
+		var id, description string
+		var accountID, categoryID int
+		var amount float64
+		if err := rows.Scan(&id, &accountID, &categoryID, &amount, &description); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read transaction: %w", err)
+		}
+		current[id] = example{categoryID: categoryID, features: strings.Join(Features(accountID, amount, description), " ")}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	for id, old := range learned {
+		if now, ok := current[id]; !ok || now != old {
+			if err := unlearn(db, id, old); err != nil {
+				return err
+			}
+		}
+	}
+	for id, now := range current {
+		if old, ok := learned[id]; !ok || now != old {
+			if err := learn(db, id, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := db.Exec(`DELETE FROM classifier_counts WHERE count <= 0`); err != nil {
+		return fmt.Errorf("failed to clean up classifier: %w", err)
+	}
+	return nil
+}
+
+// readExamples returns what the model learned from each transaction
+func readExamples(db database.DBTX) (map[string]example, error) {
+	rows, err := db.Query(`SELECT transaction_id, category_id, features FROM classifier_examples`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read classifier examples: %w", err)
+	}
+	defer rows.Close()
+
+	examples := make(map[string]example)
+	for rows.Next() {
+		var id string
+		var e example
+		if err := rows.Scan(&id, &e.categoryID, &e.features); err != nil {
+			return nil, fmt.Errorf("failed to read classifier example: %w", err)
+		}
+		examples[id] = e
+	}
+	return examples, rows.Err()
+}
+
+// readExample returns what the model learned from a transaction, if anything
+func readExample(db database.DBTX, transactionID string) (example, bool, error) {
+	var e example
+	query := `SELECT category_id, features FROM classifier_examples WHERE transaction_id = ?`
+	err := db.QueryRow(query, transactionID).Scan(&e.categoryID, &e.features)
+	if err == sql.ErrNoRows {
+		return example{}, false, nil
+	}
+	if err != nil {
+		return example{}, false, fmt.Errorf("failed to read classifier example: %w", err)
+	}
+	return e, true, nil
+}
+
+// currentExample returns what the model should learn from a transaction and its category's name. Reports
+// false when the transaction is gone or Uncategorized
+func currentExample(db database.DBTX, transactionID string) (example, string, bool, error) {
+	var e example
+	var name, description string
+	var accountID int
+	var amount float64
+	err := db.QueryRow(`
+		SELECT t.account_id, t.category_id, c.name, t.amount, COALESCE(t.raw_description, t.description, '')
+		FROM transactions t
+		JOIN categories c ON c.id = t.category_id
+		WHERE t.id = ? AND LOWER(c.name) != 'uncategorized'`, transactionID).Scan(&accountID, &e.categoryID, &name, &amount, &description)
+	if err == sql.ErrNoRows {
+		return example{}, "", false, nil
+	}
+	if err != nil {
+		return example{}, "", false, fmt.Errorf("failed to read transaction: %w", err)
+	}
+	e.features = strings.Join(Features(accountID, amount, description), " ")
+	return e, name, true, nil
+}
+
+// learn adds a transaction's features to its category's counts
+func learn(db database.DBTX, transactionID string, e example) error {
+	if _, err := db.Exec(`INSERT INTO classifier_examples (transaction_id, category_id, features) VALUES (?, ?, ?)`,
+		transactionID, e.categoryID, e.features); err != nil {
+		return fmt.Errorf("failed to store classifier example: %w", err)
+	}
+	for _, feature := range strings.Fields(e.features) {
+		query := `INSERT INTO classifier_counts (category_id, feature, count) VALUES (?, ?, 1)
+		          ON CONFLICT (category_id, feature) DO UPDATE SET count = count + 1`
+		if _, err := db.Exec(query, e.categoryID, feature); err != nil {
+			return fmt.Errorf("failed to update classifier counts: %w", err)
+		}
+	}
+	return nil
+}
+
+// unlearn takes a transaction's features back out of the counts of the category it was learned under
+func unlearn(db database.DBTX, transactionID string, e example) error {
+	if _, err := db.Exec(`DELETE FROM classifier_examples WHERE transaction_id = ?`, transactionID); err != nil {
+		return fmt.Errorf("failed to remove classifier example: %w", err)
+	}
+	for _, feature := range strings.Fields(e.features) {
+		query := `UPDATE classifier_counts SET count = count - 1 WHERE category_id = ? AND feature = ?`
+		if _, err := db.Exec(query, e.categoryID, feature); err != nil {
+			return fmt.Errorf("failed to update classifier counts: %w", err)
+		}
+	}
+	return nil
+}
+
+// add counts an example in the loaded model
+func (m *Model) add(e example, name string) {
+	counts, ok := m.categories[e.categoryID]
+	if !ok {
+		counts = &categoryCounts{name: name, features: make(map[string]int)}
+		m.categories[e.categoryID] = counts
+	}
+	counts.examples++
+	m.examples++
+	for _, feature := range strings.Fields(e.features) {
+		counts.features[feature]++
+		counts.total++
+		m.vocabulary[feature] = true
+	}
+}
+
+// forget takes an example back out of the loaded model
+func (m *Model) forget(e example) {
+	counts, ok := m.categories[e.categoryID]
+	if !ok {
+		return
+	}
+	counts.examples--
+	m.examples--
+	for _, feature := range strings.Fields(e.features) {
+		if counts.features[feature] <= 0 {
+			continue
+		}
+		counts.total--
+		if counts.features[feature]--; counts.features[feature] == 0 {
+			delete(counts.features, feature)
+			m.dropUnusedFeature(feature)
+		}
+	}
+	if counts.examples <= 0 {
+		delete(m.categories, e.categoryID)
+	}
+}
+
+// dropUnusedFeature removes a feature from the vocabulary once no category has counted it
+func (m *Model) dropUnusedFeature(feature string) {
+	for _, counts := range m.categories {
+		if counts.features[feature] > 0 {
+			return
+		}
+	}
+	delete(m.vocabulary, feature)
+}
+
+// read loads the stored counts into a model
+func read(db database.DBTX) (*Model, error) {
+	model := &Model{categories: make(map[int]*categoryCounts), vocabulary: make(map[string]bool)}
+
+	rows, err := db.Query(`
+		SELECT e.category_id, c.name, COUNT(*)
+		FROM classifier_examples e
+		JOIN categories c ON c.id = e.category_id
+		GROUP BY e.category_id, c.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read classifier categories: %w", err)
+	}
+	for rows.Next() {
+		counts := &categoryCounts{features: make(map[string]int)}
+		var id int
+		if err := rows.Scan(&id, &counts.name, &counts.examples); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read classifier category: %w", err)
+		}
+		model.categories[id] = counts
+		model.examples += counts.examples
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read classifier categories: %w", err)
+	}
+
+	rows, err = db.Query(`SELECT category_id, feature, count FROM classifier_counts`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read classifier counts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, count int
+		var feature string
+		if err := rows.Scan(&id, &feature, &count); err != nil {
+			return nil, fmt.Errorf("failed to read classifier count: %w", err)
+		}
+		counts, ok := model.categories[id]
+		if !ok {
+			continue
+		}
+		counts.features[feature] = count
+		counts.total += count
+		model.vocabulary[feature] = true
+	}
+	return model, rows.Err()
+}
@@ -1,174 +1,650 @@
 package importservice
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
 	cliUtils "github.com/HadeZForge/FortiFi/internal/cli/utils"
 	"github.com/HadeZForge/FortiFi/internal/database"
 	"github.com/HadeZForge/FortiFi/internal/dataparse"
+	"github.com/HadeZForge/FortiFi/internal/transaction/classifier"
+	"github.com/HadeZForge/FortiFi/internal/transaction/payees"
+	"github.com/HadeZForge/FortiFi/internal/transaction/rules"
 	"github.com/HadeZForge/FortiFi/internal/transaction/utils"
 	"github.com/HadeZForge/FortiFi/internal/types"
 )
 
+// DefaultDuplicateWindowDays is how many days apart probable duplicates can be when the import format doesn't say
+const DefaultDuplicateWindowDays = 3
+
 // ImportStats holds statistics about the import process
 type ImportStats struct {
-	TotalRead    int
-	TotalSkipped int
-	TotalAdded   int
+	BatchID            int
+	TotalRead          int
+	TotalSkipped       int
+	TotalAdded         int
+	Results            []ImportResult
+	Skipped            []types.SkippedRow
+	ProbableDuplicates []types.DuplicatePair
 }
 
-// ImportCSVFile imports a CSV file using the generic configuration-based approach
-func ImportCSVFile(db *sql.DB, filePath string, configPath string) (*ImportStats, error) {
-	// Initialize statistics
-	stats := &ImportStats{}
+// ImportStatus is the outcome of importing a single parsed transaction
+type ImportStatus string
+
+const (
+	StatusAdded     ImportStatus = "added"
+	StatusDuplicate ImportStatus = "duplicate"
+	StatusFailed    ImportStatus = "failed"
+)
+
+// ImportResult records what happened to one parsed transaction and how it was categorized
+type ImportResult struct {
+	Transaction   types.GenericTransaction
+	AccountName   string
+	TransactionID string
+	ExistingID    string // The stored transaction a duplicate matched, which can have a different ID
+	Status        ImportStatus
+	Category      string
+	Rule          string
+	Suggestions   []types.CategorySuggestion
+	Err           error
+}
+
+// AmbiguousFormatError is returned when several import formats fit a CSV equally well.
+// The caller can pick one of the candidates and import with ImportCSVFileWithFormat
+type AmbiguousFormatError struct {
+	FileName   string
+	Candidates []types.ImportFormat
+}
+
+func (e *AmbiguousFormatError) Error() string {
+	return fmt.Sprintf("%d import formats match file %s", len(e.Candidates), e.FileName)
+}
 
+// PreviewImport runs an import inside a database transaction that is always rolled back,
+// so the returned stats show what the import would do without changing anything
+func PreviewImport(db *sql.DB, run func(database.DBTX) (*ImportStats, error)) (*ImportStats, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin preview transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	return run(tx)
+}
+
+// ImportCSVFile imports a CSV file using the generic configuration-based approach.
+// The import format is detected from the CSV header, falling back to the file name
+func ImportCSVFile(db database.DBTX, filePath string, configPath string) (*ImportStats, error) {
 	// Load configuration
 	config, err := utils.LoadImportConfig(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load import config: %w", err)
 	}
 
-	// Find appropriate format based on filename
-	filename := filepath.Base(filePath)
-	format, err := utils.FindImportFormat(config, filename)
+	format, err := DetectCSVFormat(config, filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find import format: %w", err)
+		return nil, err
 	}
 
-	// Get keyword mappings for categorization
-	exactKeywords, err := database.GetExactKeywords(db)
+	return ImportCSVFileWithFormat(db, filePath, format)
+}
+
+// ImportCSVFileWithFormat imports a CSV file using an import format chosen by the caller
+func ImportCSVFileWithFormat(db database.DBTX, filePath string, format *types.ImportFormat) (*ImportStats, error) {
+	return importWithFormat(db, filePath, format, "CSV", dataparse.ParseGenericCSV)
+}
+
+// ImportQIFFile imports a QIF file, using the import format matched by filename for the
+// account and blacklists. Categories in the file are mapped to FortiFi categories
+func ImportQIFFile(db database.DBTX, filePath string, configPath string) (*ImportStats, error) {
+	config, err := utils.LoadImportConfig(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get exact keywords: %w", err)
+		return nil, fmt.Errorf("failed to load import config: %w", err)
 	}
 
-	includesKeywords, err := database.GetIncludesKeywords(db)
+	format, err := utils.FindImportFormat(config, filepath.Base(filePath))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get includes keywords: %w", err)
+		return nil, fmt.Errorf("failed to find import format: %w", err)
 	}
 
+	return importWithFormat(db, filePath, format, "QIF", dataparse.ParseQIF)
+}
+
+// DetectCSVFormat picks the import format for a CSV by fingerprinting its header. Formats whose
+// mapped columns are all present are candidates, and the one mapping the most columns wins.
+// Ties are broken by the file name, and an AmbiguousFormatError is returned if that doesn't settle it.
+// When no format's columns match, the format is chosen by file name alone
+func DetectCSVFormat(config *types.ImportConfig, filePath string) (*types.ImportFormat, error) {
+	filename := filepath.Base(filePath)
+
+	var candidates []types.ImportFormat
+	bestScore := 0
+	for _, format := range config.ImportFormats {
+		found, total := dataparse.MatchHeaderColumns(filePath, &format)
+		if total == 0 || found < total {
+			continue
+		}
+		if total > bestScore {
+			bestScore = total
+			candidates = nil
+		}
+		if total == bestScore {
+			candidates = append(candidates, format)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		// Find appropriate format based on filename
+		format, err := utils.FindImportFormat(config, filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find import format: %w", err)
+		}
+		return format, nil
+	case 1:
+		return &candidates[0], nil
+	}
+
+	// Several formats share the same columns, let the file name decide
+	lowerFilename := strings.ToLower(filename)
+	var byName []types.ImportFormat
+	for _, format := range candidates {
+		if format.Identifier != "" && strings.Contains(lowerFilename, strings.ToLower(format.Identifier)) {
+			byName = append(byName, format)
+		}
+	}
+	if len(byName) == 1 {
+		return &byName[0], nil
+	}
+	if len(byName) > 1 {
+		candidates = byName
+	}
+
+	return nil, &AmbiguousFormatError{FileName: filename, Candidates: candidates}
+}
+
+// importWithFormat parses a file with the given parser and imports it into the format's account
+func importWithFormat(db database.DBTX, filePath string, format *types.ImportFormat, kind string, parse func(string, *types.ImportFormat) ([]types.GenericTransaction, []types.SkippedRow, error)) (*ImportStats, error) {
 	// Get account ID
 	accountID, err := database.GetAccountID(db, format.AccountName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account ID: %w", err)
 	}
 
-	// Parse CSV file
-	transactions, err := dataparse.ParseGenericCSV(filePath, format)
+	// Parse the file
+	transactions, skipped, err := parse(filePath, format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		return nil, fmt.Errorf("failed to parse %s: %w", kind, err)
 	}
 
 	fmt.Printf("Parsed %d transactions from file: %s\n", len(transactions), filePath)
 
+	// Initialize statistics
+	stats, err := startBatch(db, filePath)
+	if err != nil {
+		return nil, err
+	}
+	stats.Skipped = append(stats.Skipped, skipped...)
+
+	if err := importTransactions(db, transactions, format, accountID, stats); err != nil {
+		return nil, err
+	}
+
+	if err := completeBatch(db, stats, formatName(format, kind), format.AccountName); err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Completed importing transactions")
+	return stats, nil
+}
+
+// ImportFile imports a statement file. camt XML is recognized by its content since bank
+// file names are opaque, everything else is chosen by the file extension
+func ImportFile(db database.DBTX, filePath string, configPath string) (*ImportStats, error) {
+	if dataparse.IsCamtFile(filePath) {
+		return ImportCamtFile(db, filePath, configPath)
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ofx", ".qfx":
+		return ImportOFXFile(db, filePath, configPath)
+	case ".qif":
+		return ImportQIFFile(db, filePath, configPath)
+	case ".xml":
+		return nil, fmt.Errorf("unrecognized XML file, only camt.052 and camt.053 are supported: %s", filePath)
+	default:
+		return ImportCSVFile(db, filePath, configPath)
+	}
+}
+
+// ImportOFXFile imports an OFX/QFX statement. Transactions are deduplicated by their FITID
+// and the statement's ledger balance is recorded as an account snapshot
+func ImportOFXFile(db database.DBTX, filePath string, configPath string) (*ImportStats, error) {
+	config, err := utils.LoadImportConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import config: %w", err)
+	}
+
+	statement, err := dataparse.ParseOFX(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OFX: %w", err)
+	}
+
+	// An import format matched by filename wins, otherwise use the statement's account number
+	filename := filepath.Base(filePath)
+	format, err := utils.FindImportFormat(config, filename)
+	if err != nil {
+		format, err = statementFormat(config, statement.AccountID, "ofx")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find import format for %s: %w", filename, err)
+		}
+	}
+
+	fmt.Printf("Parsed %d transactions from file: %s\n", len(statement.Transactions), filePath)
+
+	stats, err := startBatch(db, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := importStatement(db, statement, format, stats); err != nil {
+		return nil, err
+	}
+
+	if err := completeBatch(db, stats, formatName(format, "OFX"), format.AccountName); err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Completed importing transactions")
+	return stats, nil
+}
+
+// ImportCamtFile imports an ISO 20022 camt.053 statement or camt.052 report. Accounts are
+// matched by IBAN and each statement's closing booked balance is recorded as an account snapshot
+func ImportCamtFile(db database.DBTX, filePath string, configPath string) (*ImportStats, error) {
+	config, err := utils.LoadImportConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import config: %w", err)
+	}
+
+	statements, err := dataparse.ParseCamt(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse camt: %w", err)
+	}
+
+	stats, err := startBatch(db, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var accountNames []string
+	for i := range statements {
+		statement := &statements[i]
+
+		format, err := statementFormat(config, statement.AccountID, "camt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find import format: %w", err)
+		}
+
+		fmt.Printf("Parsed %d transactions for account %s from file: %s\n", len(statement.Transactions), format.AccountName, filePath)
+
+		if err := importStatement(db, statement, format, stats); err != nil {
+			return nil, err
+		}
+		accountNames = append(accountNames, format.AccountName)
+	}
+
+	if err := completeBatch(db, stats, "camt", strings.Join(accountNames, ", ")); err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Completed importing transactions")
+	return stats, nil
+}
+
+// importStatement records a statement's closing balance and imports its transactions
+func importStatement(db database.DBTX, statement *types.ParsedStatement, format *types.ImportFormat, stats *ImportStats) error {
+	accountID, err := database.GetAccountID(db, format.AccountName)
+	if err != nil {
+		return fmt.Errorf("failed to get account ID: %w", err)
+	}
+
+	if statement.ClosingBalance != nil {
+		_, err = database.InsertAccountSnapshot(db, accountID, statement.BalanceDate, *statement.ClosingBalance, stats.BatchID)
+		if err != nil {
+			cliUtils.PrintError("inserting account snapshot", err)
+		}
+	}
+
+	transactions, blacklisted := dataparse.FilterBlacklisted(statement.Transactions, format)
+	stats.Skipped = append(stats.Skipped, statement.Skipped...)
+	stats.Skipped = append(stats.Skipped, blacklisted...)
+	return importTransactions(db, transactions, format, accountID, stats)
+}
+
+// statementFormat finds the import format for a self-describing statement by its account number.
+// Without one, an account named after the last digits of the account number is used
+func statementFormat(config *types.ImportConfig, accountNumber string, prefix string) (*types.ImportFormat, error) {
+	if format, err := utils.FindImportFormatByAccount(config, accountNumber); err == nil {
+		return format, nil
+	}
+
+	if accountNumber == "" {
+		return nil, fmt.Errorf("statement has no account number and no import format matches")
+	}
+
+	format := &types.ImportFormat{AccountName: prefix + "-" + lastChars(accountNumber, 4)}
+	fmt.Printf("No import format matches account %s, using account '%s'\n", accountNumber, format.AccountName)
+	return format, nil
+}
+
+// importTransactions categorizes and inserts parsed transactions, skipping any that already exist,
+// then looks for earlier transactions the new ones probably duplicate
+func importTransactions(db database.DBTX, transactions []types.GenericTransaction, format *types.ImportFormat, accountID int, stats *ImportStats) error {
+	// Get the rules for categorization
+	ruleList, err := importRules(db, format, accountID)
+	if err != nil {
+		return err
+	}
+
 	// Set total read count
-	stats.TotalRead = len(transactions)
+	stats.TotalRead += len(transactions)
+	firstResult := len(stats.Results)
+
+	normalizer, err := payees.Load(db)
+	if err != nil {
+		return err
+	}
+
+	// The classifier is only loaded once a transaction ends up Uncategorized
+	var model *classifier.Model
+	modelLoaded := false
 
 	// Process each transaction
 	for _, transaction := range transactions {
 		// Handle balance tracking if configured
 		if format.TrackBalance && transaction.Balance != nil {
-			_, err = database.InsertAccountSnapshot(db, accountID, transaction.Date, *transaction.Balance)
+			_, err = database.InsertAccountSnapshot(db, accountID, transaction.Date, *transaction.Balance, stats.BatchID)
 			if err != nil {
 				cliUtils.PrintError("inserting account snapshot", err)
 				continue
 			}
 		}
 
+		outcome := rules.Evaluate(ruleList, rules.Transaction{
+			AccountID:   accountID,
+			Date:        transaction.Date,
+			Amount:      transaction.Amount,
+			Description: transaction.Description,
+			PayeeID:     normalizer.Match(normalizer.Clean(transaction.Description)),
+		})
+		if outcome.IgnoreRule != nil {
+			fmt.Printf("Skipping transaction ignored by rule %d: %s\n", outcome.IgnoreRule.ID, transaction.Description)
+			stats.Skipped = append(stats.Skipped, types.SkippedRow{
+				Row:         fmt.Sprintf("rule %d", outcome.IgnoreRule.ID),
+				Description: transaction.Description,
+				Reason:      "ignored by rule",
+				Blacklisted: true,
+			})
+			stats.TotalSkipped++
+			continue
+		}
+
+		result := ImportResult{Transaction: transaction, AccountName: format.AccountName}
+
 		// Determine category
-		categoryID, err := determineCategory(db, transaction, format, exactKeywords, includesKeywords)
+		categoryID, decision, err := determineCategory(db, transaction, outcome)
 		if err != nil {
 			cliUtils.PrintError("categorizing transaction", err)
-			stats.TotalSkipped++
+			stats.addResult(result, StatusFailed, err)
 			continue
 		}
+		result.Rule = decision.Reason
+		result.Category, err = database.GetCategoryNameByID(db, categoryID)
+		if err != nil {
+			cliUtils.PrintError("getting category name", err)
+		}
 
-		// Generate transaction ID with daily sequence
-		transactionID := utils.GenerateTransactionHash(
-			transaction.Date,
-			transaction.Amount,
-			transaction.Description,
-			transaction.DailySequence)
+		// Fingerprint the transaction, preferring the institution's own identifier when present.
+		// The original description is used even when a rule rewrites it
+		var fingerprint string
+		if transaction.ExternalID != "" {
+			fingerprint = utils.GenerateExternalTransactionHash(transaction.ExternalID)
+		} else {
+			fingerprint = utils.GenerateTransactionHash(
+				transaction.Date,
+				transaction.Amount,
+				transaction.Description,
+				transaction.DailySequence)
+		}
+		transactionID := utils.GenerateTransactionID(accountID, fingerprint)
+		result.TransactionID = transactionID
 
-		// Check if transaction already exists
-		exists, err := database.TransactionExists(db, transactionID)
+		// Check if the account already has this transaction
+		result.ExistingID, err = database.FindTransactionByFingerprint(db, accountID, fingerprint)
 		if err != nil {
 			cliUtils.PrintError("checking transaction existence", err)
-			stats.TotalSkipped++
+			stats.addResult(result, StatusFailed, err)
 			continue
 		}
-		if exists {
-			fmt.Printf("Transaction already exists, skipping: %s\n", transactionID[:8])
-			stats.TotalSkipped++
+		if result.ExistingID != "" {
+			fmt.Printf("Transaction already exists, skipping: %s\n", result.ExistingID[:8])
+			stats.addResult(result, StatusDuplicate, nil)
+			continue
+		}
+
+		// The payee comes from the original description, which is kept even when a rule rewrites it
+		payeeID, err := payees.Resolve(db, normalizer, transaction.Description)
+		if err != nil {
+			cliUtils.PrintError("finding payee", err)
+			stats.addResult(result, StatusFailed, err)
 			continue
 		}
 
 		// Insert transaction
-		query := `INSERT INTO transactions (id, account_id, category_id, amount, transaction_date, description) 
-		          VALUES (?, ?, ?, ?, ?, ?)`
+		query := `INSERT INTO transactions (id, account_id, category_id, amount, transaction_date, description, raw_description, payee_id,
+		              import_batch_id, import_fingerprint, is_transfer, category_source, category_rule_id, category_reason, category_decided_at)
+		          VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, NULLIF(?, 0), ?, CURRENT_TIMESTAMP)`
 
-		_, err = db.Exec(query, transactionID, accountID, categoryID, transaction.Amount, transaction.Date, transaction.Description)
+		_, err = db.Exec(query, transactionID, accountID, categoryID, transaction.Amount, transaction.Date, outcome.Description, transaction.Description, payeeID,
+			stats.BatchID, fingerprint, outcome.Transfer, decision.Source, decision.RuleID, decision.Reason)
 		if err != nil {
 			cliUtils.PrintError("inserting transaction", err)
 			fmt.Printf("Skipping transaction with amount: %.2f and description: %s\n", transaction.Amount, transaction.Description)
-			stats.TotalSkipped++
+			stats.addResult(result, StatusFailed, err)
 			continue
 		}
 
+		if err := database.InsertTransactionMetadata(db, transactionID, transaction.Metadata); err != nil {
+			cliUtils.PrintWarning("storing transaction metadata", err)
+		}
+		if _, err := database.InsertTransactionTags(db, transactionID, outcome.Tags); err != nil {
+			cliUtils.PrintWarning("storing transaction tags", err)
+		}
+
+		// Suggest categories for transactions no rule categorized
+		if decision.Source == types.CategorySourceDefault {
+			if !modelLoaded {
+				modelLoaded = true
+				if model, err = classifier.Load(db); err != nil {
+					cliUtils.PrintWarning("loading category classifier", err)
+				}
+			}
+			result.Suggestions = model.Suggest(accountID, transaction.Amount, transaction.Description, classifier.SuggestionCount)
+		}
+
 		// Transaction successfully added
-		stats.TotalAdded++
+		stats.addResult(result, StatusAdded, nil)
 	}
 
-	fmt.Println("Completed importing transactions")
-	return stats, nil
+	return findProbableDuplicates(db, stats, stats.Results[firstResult:], format)
 }
 
-// Helpers
-func categorizeTransaction(db *sql.DB, description string, defaultCategory string, exactKeywords map[string]int, includesKeywords map[string]int) (int, error) {
-	var categoryID int
-	var err error
+// importRules returns the stored rules with the import format's special rules ahead of them
+func importRules(db database.DBTX, format *types.ImportFormat, accountID int) ([]types.Rule, error) {
+	stored, err := rules.Load(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ruleList []types.Rule
+	for _, special := range format.SpecialRules {
+		categoryID, err := database.GetCategoryID(db, special.ForceCategory)
+		if err != nil {
+			cliUtils.PrintWarning(fmt.Sprintf("loading special rule '%s'", special.DescriptionExact), err)
+			continue
+		}
+		ruleList = append(ruleList, rules.FromSpecialRule(special, accountID, categoryID))
+	}
 
-	// First check exact keywords (highest priority)
-	if id, exists := exactKeywords[description]; exists {
-		return id, nil
+	return append(ruleList, stored...), nil
+}
+
+// findProbableDuplicates records earlier transactions that look like the same purchase as newly
+// added ones, e.g. a pending charge whose posted version has a different description. Rows this
+// file exactly matched are left out since the file lists them separately from the new rows
+func findProbableDuplicates(db database.DBTX, stats *ImportStats, results []ImportResult, format *types.ImportFormat) error {
+	windowDays := format.DuplicateWindowDays
+	if windowDays == 0 {
+		windowDays = DefaultDuplicateWindowDays
+	}
+	if windowDays < 0 {
+		return nil
 	}
 
-	// Then check includes keywords
-	for keyword, id := range includesKeywords {
-		if strings.Contains(description, keyword) {
-			return id, nil
+	before := len(stats.ProbableDuplicates)
+	matched := make(map[string]bool)
+	for _, result := range results {
+		if result.Status == StatusDuplicate {
+			matched[result.ExistingID] = true
 		}
 	}
 
-	// If no keyword match found, use default category or create new one
-	categoryID, err = database.GetCategoryID(db, defaultCategory)
-	if err != nil {
-		categoryID, err = database.InsertCategory(db, defaultCategory)
+	for _, result := range results {
+		if result.Status != StatusAdded {
+			continue
+		}
+
+		pairs, err := database.FindProbableDuplicates(db, result.TransactionID, windowDays)
 		if err != nil {
-			return 0, fmt.Errorf("failed to get/create category ID: %w", err)
+			return fmt.Errorf("failed to check for probable duplicates: %w", err)
+		}
+		for _, pair := range pairs {
+			if !matched[pair.Existing.Id] {
+				stats.ProbableDuplicates = append(stats.ProbableDuplicates, pair)
+			}
 		}
 	}
 
-	return categoryID, nil
+	if found := len(stats.ProbableDuplicates) - before; found > 0 {
+		fmt.Printf("Found %d probable duplicate(s) of earlier transactions\n", found)
+	}
+	return nil
 }
 
-// determineCategory determines the category for a transaction based on rules and keywords
-func determineCategory(db *sql.DB, transaction types.GenericTransaction, format *types.ImportFormat, exactKeywords map[string]int, includesKeywords map[string]int) (int, error) {
-	// Check special rules first
-	for _, rule := range format.SpecialRules {
-		if transaction.Description == rule.DescriptionExact {
-			// Check amount if specified
-			if rule.AmountExact != nil && !utils.CompareFloats(transaction.Amount, *rule.AmountExact) {
-				continue
-			}
+// addResult records the outcome of one transaction and updates the counters
+func (s *ImportStats) addResult(result ImportResult, status ImportStatus, err error) {
+	result.Status = status
+	result.Err = err
+	s.Results = append(s.Results, result)
+
+	if status == StatusAdded {
+		s.TotalAdded++
+	} else {
+		s.TotalSkipped++
+	}
+}
 
-			// This rule matches, use the forced category
-			return database.GetCategoryID(db, rule.ForceCategory)
+// startBatch records a new import batch for a file and returns the stats that will be linked to it
+func startBatch(db database.DBTX, filePath string) (*ImportStats, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file for checksum: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	previousID, err := database.FindImportBatchByChecksum(db, checksum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check import history: %w", err)
+	}
+	if previousID != 0 {
+		fmt.Printf("Note: this file was already imported in batch %d\n", previousID)
+	}
+
+	batchID, err := database.InsertImportBatch(db, filepath.Base(filePath), checksum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record import batch: %w", err)
+	}
+
+	return &ImportStats{BatchID: batchID}, nil
+}
+
+// completeBatch stores the final counts of an import on its batch
+func completeBatch(db database.DBTX, stats *ImportStats, format string, accountName string) error {
+	err := database.CompleteImportBatch(db, types.ImportBatch{
+		ID:           stats.BatchID,
+		Format:       format,
+		AccountName:  accountName,
+		TotalRead:    stats.TotalRead,
+		TotalSkipped: stats.TotalSkipped,
+		TotalAdded:   stats.TotalAdded,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete import batch: %w", err)
+	}
+	return nil
+}
+
+// formatName names the import format used for a batch, falling back to the file kind
+func formatName(format *types.ImportFormat, kind string) string {
+	if format.Identifier != "" {
+		return format.Identifier
+	}
+	return strings.ToLower(kind)
+}
+
+// lastChars returns the last n characters of s, or s itself if it is shorter
+func lastChars(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// Helpers
+// determineCategory determines the category for a transaction from the rules that matched it,
+// along with what decided it
+func determineCategory(db database.DBTX, transaction types.GenericTransaction, outcome rules.Result) (int, types.CategoryDecision, error) {
+	// Special rules from the import config come first, they are the only rules without an ID
+	if outcome.CategoryRule != nil && outcome.CategoryRule.ID == 0 {
+		decision := types.CategoryDecision{Source: types.CategorySourceSpecialRule, Reason: rules.Label(*outcome.CategoryRule)}
+		return outcome.CategoryID, decision, nil
+	}
+
+	// The user's own rules override whatever the bank put in the file
+	if outcome.CategoryRule != nil {
+		decision := types.CategoryDecision{
+			Source: types.CategorySourceRule,
+			RuleID: outcome.CategoryRule.ID,
+			Reason: rules.Label(*outcome.CategoryRule),
 		}
+		return outcome.CategoryID, decision, nil
+	}
+
+	// Categories supplied by the source file (e.g. QIF) map to FortiFi categories, creating them if needed
+	if transaction.Category != "" {
+		categoryID, err := database.GetCategoryID(db, transaction.Category)
+		return categoryID, types.CategoryDecision{Source: types.CategorySourceFile, Reason: "category from file"}, err
 	}
 
-	// Use shared categorization logic with "Uncategorized" as default
-	return categorizeTransaction(db, transaction.Description, "Uncategorized", exactKeywords, includesKeywords)
+	// If no rule matched, use the default category
+	categoryID, err := database.GetCategoryID(db, "Uncategorized")
+	return categoryID, types.CategoryDecision{Source: types.CategorySourceDefault, Reason: "default"}, err
 }
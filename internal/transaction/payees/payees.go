@@ -0,0 +1,235 @@
+package payees
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/HadeZForge/FortiFi/internal/database"
+	txnUtils "github.com/HadeZForge/FortiFi/internal/transaction/utils"
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// processorPrefix matches the card processor or wallet written in front of a merchant, like the "SQ *" in
+// "SQ *BLUE BOTTLE". It is removed before the stored rewrites run
+var processorPrefix = regexp.MustCompile(`(?i)^\s*(SQ|TST|SP|PP|PY|PAYPAL|IC|DD|DNH|CKO|BT|LS|WPY|GOOGLE)\s?\*\s*`)
+
+// Normalizer turns raw descriptions into payees using the stored rewrites and aliases
+type Normalizer struct {
+	rewrites []rewrite
+	exact    map[string]int
+	prefixes []types.PayeeAlias
+}
+
+// rewrite is a compiled payee rewrite
+type rewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Load reads the stored rewrites and aliases
+func Load(db database.DBTX) (*Normalizer, error) {
+	normalizer := &Normalizer{exact: make(map[string]int)}
+
+	stored, err := database.GetPayeeRewrites(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range stored {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payee rewrite %d: %w", r.ID, err)
+		}
+		normalizer.rewrites = append(normalizer.rewrites, rewrite{pattern: pattern, replacement: r.Replacement})
+	}
+
+	aliases, err := database.GetPayeeAliases(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		if alias.Prefix {
+			normalizer.prefixes = append(normalizer.prefixes, alias)
+		} else {
+			normalizer.exact[alias.Alias] = alias.PayeeID
+		}
+	}
+	// The longest prefix is checked first so "AMAZON PRIME" wins over "AMAZON"
+	slices.SortStableFunc(normalizer.prefixes, func(a, b types.PayeeAlias) int { return len(b.Alias) - len(a.Alias) })
+
+	return normalizer, nil
+}
+
+// ValidateRewrite checks that a rewrite's pattern compiles
+func ValidateRewrite(r types.PayeeRewrite) error {
+	if strings.TrimSpace(r.Pattern) == "" {
+		return fmt.Errorf("pattern cannot be empty")
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		return fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return nil
+}
+
+// CleanAlias puts an alias in the form cleaned descriptions are compared in
+func CleanAlias(alias string) string {
+	return txnUtils.NormalizeDescription(alias)
+}
+
+// Clean removes the processor prefix from a raw description, applies the stored rewrites in order and
+// normalizes what is left, e.g. "SQ *BLUE BOTTLE 0423 OAKLAND CA" becomes "BLUE BOTTLE"
+func (n *Normalizer) Clean(description string) string {
+	description = processorPrefix.ReplaceAllString(description, "")
+	for _, r := range n.rewrites {
+		description = r.pattern.ReplaceAllString(description, r.replacement)
+	}
+	return txnUtils.NormalizeDescription(description)
+}
+
+// Match returns the payee a cleaned description belongs to, or 0 when no alias matches. Prefix aliases
+// are checked before the aliases of payees created automatically
+func (n *Normalizer) Match(clean string) int {
+	if clean == "" {
+		return 0
+	}
+	for _, alias := range n.prefixes {
+		if clean == alias.Alias || strings.HasPrefix(clean, alias.Alias+" ") {
+			return alias.PayeeID
+		}
+	}
+	return n.exact[clean]
+}
+
+// Resolve returns the payee of a raw description, creating a payee named after the cleaned description
+// when no alias matches. Returns 0 for descriptions that clean down to nothing
+func Resolve(db database.DBTX, n *Normalizer, description string) (int, error) {
+	clean := n.Clean(description)
+	if clean == "" {
+		return 0, nil
+	}
+	if payeeID := n.Match(clean); payeeID != 0 {
+		return payeeID, nil
+	}
+
+	name := displayName(clean)
+	payeeID, err := database.FindPayee(db, name)
+	if err != nil {
+		return 0, err
+	}
+	if payeeID == 0 {
+		if payeeID, err = database.InsertPayee(db, name); err != nil {
+			return 0, err
+		}
+	}
+	if err := database.SetPayeeAlias(db, types.PayeeAlias{Alias: clean, PayeeID: payeeID}); err != nil {
+		return 0, err
+	}
+	n.exact[clean] = payeeID
+	return payeeID, nil
+}
+
+// AssignMissing gives a payee to the transactions that don't have one yet, such as those imported by
+// earlier versions or added by hand. Runs in its own transaction when given a database. Returns how
+// many transactions got a payee
+func AssignMissing(db database.DBTX) (int, error) {
+	if sqlDB, ok := db.(*sql.DB); ok {
+		tx, err := sqlDB.Begin()
+		if err != nil {
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		assigned, err := AssignMissing(tx)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit payees: %w", err)
+		}
+		return assigned, nil
+	}
+
+	return resolve(db, `WHERE payee_id IS NULL`)
+}
+
+// ResolveAll works out the payee of every transaction again after rewrites or aliases changed. Returns
+// how many transactions changed payee
+func ResolveAll(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	changed, err := resolve(tx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit payees: %w", err)
+	}
+	return changed, nil
+}
+
+// resolve works out the payee of the transactions a where clause selects from their raw description
+// and stores the ones that changed. Returns how many changed
+func resolve(db database.DBTX, where string) (int, error) {
+	normalizer, err := Load(db)
+	if err != nil {
+		return 0, err
+	}
+
+	type stored struct {
+		id          string
+		description string
+		payeeID     int
+	}
+	rows, err := db.Query(`SELECT id, COALESCE(raw_description, description, ''), COALESCE(payee_id, 0) FROM transactions ` + where)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read transactions: %w", err)
+	}
+	var transactions []stored
+	for rows.Next() {
+		var t stored
+		if err := rows.Scan(&t.id, &t.description, &t.payeeID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to read transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	changed := 0
+	for _, t := range transactions {
+		payeeID, err := Resolve(db, normalizer, t.description)
+		if err != nil {
+			return 0, err
+		}
+		if payeeID == t.payeeID {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE transactions SET payee_id = NULLIF(?, 0) WHERE id = ?`, payeeID, t.id); err != nil {
+			return 0, fmt.Errorf("failed to update payee: %w", err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// displayName turns a cleaned description into a payee name, e.g. "BLUE BOTTLE" becomes "Blue Bottle"
+func displayName(clean string) string {
+	words := strings.Fields(strings.ToLower(clean))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
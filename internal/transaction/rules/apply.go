@@ -0,0 +1,279 @@
+package rules
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// storedTransaction is a transaction already in the database, as rules see it. Description is the one
+// shown now, which a rule may have rewritten, while Transaction holds the original description that
+// conditions are checked against
+type storedTransaction struct {
+	ID             string
+	CategoryID     int
+	CategoryName   string
+	CategorySource string
+	CategoryRuleID int
+	Description    string
+	Transaction    Transaction
+}
+
+// uncategorized reports whether the transaction has no real category yet
+func (stored storedTransaction) uncategorized() bool {
+	return stored.CategoryID == 0 || strings.EqualFold(stored.CategoryName, "Uncategorized")
+}
+
+// categorizedByRule reports whether a stored rule is recorded as deciding the transaction's category
+func (stored storedTransaction) categorizedByRule() bool {
+	return stored.CategorySource == types.CategorySourceRule && stored.CategoryRuleID != 0
+}
+
+// table returns the transaction in the form the transaction tables print
+func (stored storedTransaction) table() types.TableTransaction {
+	return types.TableTransaction{
+		Id:          stored.ID,
+		AccountID:   stored.Transaction.AccountID,
+		CategoryID:  stored.CategoryID,
+		Amount:      stored.Transaction.Amount,
+		Date:        stored.Transaction.Date.Format("2006-01-02"),
+		Description: stored.Description,
+	}
+}
+
+// Preview is what saving a rule would do to the stored transactions. Category moves are split into
+// transactions leaving Uncategorized and transactions taken from another category
+type Preview struct {
+	FromUncategorized   []types.TableTransaction
+	FromOtherCategories []types.TableTransaction
+	Renamed             int
+}
+
+// Load returns the stored rules in the order they are checked
+func Load(db database.DBTX) ([]types.Rule, error) {
+	ruleList, err := database.GetRules(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rules: %w", err)
+	}
+	Sort(ruleList)
+	return ruleList, nil
+}
+
+// Stats is how many stored transactions meet a rule's conditions, and how many of those currently hold
+// the category the rule decides for them
+type Stats struct {
+	Matched     int
+	Categorized int
+}
+
+// ComputeStats checks the stored transactions against rules sorted in the order they are checked and
+// counts the matches of each rule by ID. Transactions recorded as categorized by a rule count as
+// categorized by it even when its conditions changed since
+func ComputeStats(db database.DBTX, ruleList []types.Rule) (map[int]Stats, error) {
+	transactions, err := loadTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int]Stats)
+	for _, stored := range transactions {
+		result := Evaluate(ruleList, stored.Transaction)
+		for _, rule := range result.Matched {
+			ruleStats := stats[rule.ID]
+			ruleStats.Matched++
+			stats[rule.ID] = ruleStats
+		}
+		if result.CategoryRule != nil && stored.CategoryID == result.CategoryID {
+			ruleStats := stats[result.CategoryRule.ID]
+			ruleStats.Categorized++
+			stats[result.CategoryRule.ID] = ruleStats
+		} else if stored.categorizedByRule() {
+			ruleStats := stats[stored.CategoryRuleID]
+			ruleStats.Categorized++
+			stats[stored.CategoryRuleID] = ruleStats
+		}
+	}
+	return stats, nil
+}
+
+// CategorizedBy returns the IDs of the stored transactions that hold the category a rule decides for them
+// or that are recorded as categorized by it, leaving out those categorized by hand
+func CategorizedBy(db database.DBTX, ruleID int) ([]string, error) {
+	ruleList, err := Load(db)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := loadTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, stored := range transactions {
+		result := Evaluate(ruleList, stored.Transaction)
+		decided := decides(result.CategoryRule, ruleID) && stored.CategoryID == result.CategoryID
+		recorded := stored.categorizedByRule() && stored.CategoryRuleID == ruleID
+		if (decided || recorded) && stored.CategorySource != types.CategorySourceManual {
+			ids = append(ids, stored.ID)
+		}
+	}
+	return ids, nil
+}
+
+// PreviewRule runs every rule, plus the given one, over the stored transactions and collects those whose
+// category or description the given rule would decide, skipping categories set by hand. The rule can be
+// new (ID 0) or a stored rule with changed conditions or actions
+func PreviewRule(db database.DBTX, rule types.Rule) (Preview, error) {
+	var preview Preview
+
+	ruleList, err := Load(db)
+	if err != nil {
+		return preview, err
+	}
+	ruleList = slices.DeleteFunc(ruleList, func(stored types.Rule) bool { return stored.ID == rule.ID })
+	ruleList = append(ruleList, rule)
+	Sort(ruleList)
+
+	transactions, err := loadTransactions(db)
+	if err != nil {
+		return preview, err
+	}
+
+	for _, stored := range transactions {
+		result := Evaluate(ruleList, stored.Transaction)
+
+		if decides(result.CategoryRule, rule.ID) && stored.CategoryID != result.CategoryID && stored.CategorySource != types.CategorySourceManual {
+			if stored.uncategorized() {
+				preview.FromUncategorized = append(preview.FromUncategorized, stored.table())
+			} else {
+				preview.FromOtherCategories = append(preview.FromOtherCategories, stored.table())
+			}
+		}
+		if decides(result.DescriptionRule, rule.ID) && stored.Description != result.Description {
+			preview.Renamed++
+		}
+	}
+
+	return preview, nil
+}
+
+// ApplyRule runs every rule over the stored transactions and applies the actions the given rule decides,
+// so a new rule only changes transactions no higher priority rule already claims. Categories set by hand
+// are kept and ignore actions only apply to imports. Returns the number of transactions changed
+func ApplyRule(db *sql.DB, ruleID int) (int, error) {
+	ruleList, err := Load(db)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	transactions, err := loadTransactions(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, stored := range transactions {
+		result := Evaluate(ruleList, stored.Transaction)
+
+		var rule *types.Rule
+		for i := range result.Matched {
+			if result.Matched[i].ID == ruleID {
+				rule = &result.Matched[i]
+			}
+		}
+		if rule == nil {
+			continue
+		}
+
+		changes := 0
+		if decides(result.CategoryRule, ruleID) && stored.CategoryID != result.CategoryID && stored.CategorySource != types.CategorySourceManual {
+			decision := types.CategoryDecision{Source: types.CategorySourceRule, RuleID: ruleID, Reason: Label(*result.CategoryRule)}
+			if err := database.SetTransactionCategory(tx, stored.ID, result.CategoryID, decision); err != nil {
+				return 0, err
+			}
+			changes++
+		}
+		if decides(result.DescriptionRule, ruleID) && stored.Description != result.Description {
+			// The original description is kept so rules keep matching the transaction after renaming it
+			query := `UPDATE transactions SET raw_description = COALESCE(raw_description, description), description = ? WHERE id = ?`
+			if _, err := tx.Exec(query, result.Description, stored.ID); err != nil {
+				return 0, fmt.Errorf("failed to update description: %w", err)
+			}
+			changes++
+		}
+		if rule.Actions.Tag != "" {
+			added, err := database.InsertTransactionTags(tx, stored.ID, []string{rule.Actions.Tag})
+			if err != nil {
+				return 0, fmt.Errorf("failed to tag transaction: %w", err)
+			}
+			changes += added
+		}
+		if rule.Actions.MarkTransfer {
+			res, err := tx.Exec(`UPDATE transactions SET is_transfer = 1 WHERE id = ? AND is_transfer = 0`, stored.ID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to mark transfer: %w", err)
+			}
+			if rows, _ := res.RowsAffected(); rows > 0 {
+				changes++
+			}
+		}
+
+		if changes > 0 {
+			changed++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return changed, nil
+}
+
+// decides reports whether the rule that decided an action is the rule with the given ID
+func decides(rule *types.Rule, ruleID int) bool {
+	return rule != nil && rule.ID == ruleID
+}
+
+// loadTransactions reads every stored transaction with the details rules check. Conditions are checked
+// against the description the transaction was imported with, before any rule rewrote it
+func loadTransactions(db database.DBTX) ([]storedTransaction, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.account_id, COALESCE(t.category_id, 0), COALESCE(c.name, ''), COALESCE(t.category_source, ''),
+		       COALESCE(t.category_rule_id, 0), t.amount, t.transaction_date, COALESCE(t.description, ''), COALESCE(t.raw_description, t.description, ''),
+		       COALESCE(t.payee_id, 0)
+		FROM transactions t
+		LEFT JOIN categories c ON t.category_id = c.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []storedTransaction
+	for rows.Next() {
+		var stored storedTransaction
+		var date time.Time
+		t := &stored.Transaction
+		if err := rows.Scan(&stored.ID, &t.AccountID, &stored.CategoryID, &stored.CategoryName, &stored.CategorySource,
+			&stored.CategoryRuleID, &t.Amount, &date, &stored.Description, &t.Description, &t.PayeeID); err != nil {
+			return nil, fmt.Errorf("failed to read transaction: %w", err)
+		}
+		t.Date = date
+		transactions = append(transactions, stored)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+	return transactions, nil
+}
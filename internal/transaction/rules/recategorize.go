@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/database"
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// Scope limits which stored transactions are recategorized. Unset fields don't limit anything
+type Scope struct {
+	AccountID         int
+	DateFrom          *time.Time
+	DateTo            *time.Time
+	UncategorizedOnly bool
+}
+
+// Change is a stored transaction moving to another category. A CategoryID of 0 is the Uncategorized
+// category when it doesn't exist yet, it is created when the change is applied
+type Change struct {
+	Transaction  types.TableTransaction
+	FromCategory string
+	CategoryID   int
+	CategoryName string
+	Decision     types.CategoryDecision
+}
+
+// Plan is what recategorizing would do. Kept counts the transactions in scope left alone because their
+// category was set by hand or by a special rule, which come before stored rules, or came from the
+// imported file and no stored rule overrides it
+type Plan struct {
+	Changes    []Change
+	KeptManual int
+	KeptImport int
+}
+
+// PlanRecategorize runs every rule in priority order over the stored transactions in scope and works out
+// which would change category. A transaction categorized by a rule that has since been deleted goes back
+// to Uncategorized when no other rule matches it, other transactions no rule matches keep their category
+func PlanRecategorize(db database.DBTX, scope Scope) (Plan, error) {
+	var plan Plan
+
+	ruleList, err := Load(db)
+	if err != nil {
+		return plan, err
+	}
+	transactions, err := loadTransactions(db)
+	if err != nil {
+		return plan, err
+	}
+	// Only looked up, so planning never writes. ApplyChanges creates the category if it is missing
+	uncategorizedID, err := database.FindCategoryID(db, "Uncategorized")
+	if err != nil {
+		return plan, err
+	}
+
+	ruleIDs := make(map[int]bool, len(ruleList))
+	for _, rule := range ruleList {
+		ruleIDs[rule.ID] = true
+	}
+
+	for _, stored := range transactions {
+		if !scope.includes(stored) {
+			continue
+		}
+
+		switch stored.CategorySource {
+		case types.CategorySourceManual:
+			plan.KeptManual++
+			continue
+		case types.CategorySourceSpecialRule:
+			plan.KeptImport++
+			continue
+		}
+
+		change := Change{Transaction: stored.table(), FromCategory: stored.CategoryName}
+		result := Evaluate(ruleList, stored.Transaction)
+		if result.CategoryRule == nil && stored.CategorySource == types.CategorySourceFile {
+			plan.KeptImport++
+			continue
+		}
+		switch {
+		case result.CategoryRule != nil:
+			change.CategoryID = result.CategoryID
+			change.CategoryName = result.CategoryRule.Actions.CategoryName
+			change.Decision = types.CategoryDecision{
+				Source: types.CategorySourceRule,
+				RuleID: result.CategoryRule.ID,
+				Reason: Label(*result.CategoryRule),
+			}
+		case stored.CategorySource == types.CategorySourceRule && !ruleIDs[stored.CategoryRuleID]:
+			change.CategoryID = uncategorizedID
+			change.CategoryName = "Uncategorized"
+			change.Decision = types.CategoryDecision{Source: types.CategorySourceDefault, Reason: "default"}
+		default:
+			continue
+		}
+
+		if change.CategoryID != stored.CategoryID {
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyChanges moves every transaction in changes to its new category in one transaction
+func ApplyChanges(db *sql.DB, changes []Change) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		categoryID := change.CategoryID
+		if categoryID == 0 {
+			if categoryID, err = database.GetCategoryID(tx, "Uncategorized"); err != nil {
+				return err
+			}
+		}
+		if err := database.SetTransactionCategory(tx, change.Transaction.Id, categoryID, change.Decision); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return nil
+}
+
+// includes reports whether a stored transaction is within the scope
+func (scope Scope) includes(stored storedTransaction) bool {
+	if scope.AccountID != 0 && stored.Transaction.AccountID != scope.AccountID {
+		return false
+	}
+	day := stored.Transaction.Date.Format("2006-01-02")
+	if scope.DateFrom != nil && day < scope.DateFrom.Format("2006-01-02") {
+		return false
+	}
+	if scope.DateTo != nil && day > scope.DateTo.Format("2006-01-02") {
+		return false
+	}
+	return !scope.UncategorizedOnly || stored.uncategorized()
+}
@@ -0,0 +1,361 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// SpecialRulePriority puts special rules from the import config ahead of every stored rule
+const SpecialRulePriority = 1 << 30
+
+// Transaction holds the details of a transaction that rules are checked against
+type Transaction struct {
+	AccountID   int
+	Date        time.Time
+	Amount      float64
+	Description string
+	PayeeID     int
+}
+
+// Result is what the matching rules decided for a transaction. Each kind of action is taken from
+// the highest priority rule that has it, tags are collected from every matching rule
+type Result struct {
+	CategoryID      int
+	CategoryRule    *types.Rule
+	Description     string
+	DescriptionRule *types.Rule
+	Tags            []string
+	Transfer        bool
+	IgnoreRule      *types.Rule
+	Matched         []types.Rule
+}
+
+// amountTolerance absorbs floating point noise when comparing amounts
+const amountTolerance = 0.005
+
+// regexCache holds compiled rule regular expressions by pattern
+var regexCache sync.Map
+
+// Conflict is an existing rule whose keyword overlaps a new rule's keyword but sets a different category
+type Conflict struct {
+	Rule types.Rule
+	// CheckedFirst is true when the existing rule decides descriptions that match both
+	CheckedFirst bool
+}
+
+// Sort orders rules the way they are checked: highest priority first, then the longest description
+// text so "AMAZON PRIME" is checked before "AMAZON", then oldest first. Rules that aren't stored yet
+// (ID 0) count as the newest
+func Sort(ruleList []types.Rule) {
+	slices.SortStableFunc(ruleList, compare)
+}
+
+// compare orders two rules for Sort
+func compare(a types.Rule, b types.Rule) int {
+	if a.Priority != b.Priority {
+		return b.Priority - a.Priority
+	}
+	if lengthA, lengthB := len(descriptionText(a)), len(descriptionText(b)); lengthA != lengthB {
+		return lengthB - lengthA
+	}
+	switch {
+	case a.ID == b.ID:
+		return 0
+	case a.ID == 0:
+		return 1
+	case b.ID == 0:
+		return -1
+	}
+	return a.ID - b.ID
+}
+
+// descriptionText returns the longest plain text a rule looks for in descriptions. Regular expressions don't count
+func descriptionText(rule types.Rule) string {
+	longest := ""
+	c := rule.Conditions
+	for _, text := range []string{c.DescriptionExact, c.DescriptionContains, c.DescriptionStartsWith} {
+		if len(text) > len(longest) {
+			longest = text
+		}
+	}
+	return longest
+}
+
+// Conflicts finds the includes rules whose keyword contains, or is contained in, the includes keyword
+// of a new rule while setting a different category. A description can match both, so only one of
+// them decides its category
+func Conflicts(ruleList []types.Rule, rule types.Rule) []Conflict {
+	keyword := rule.Conditions.DescriptionContains
+	if keyword == "" {
+		return nil
+	}
+
+	var conflicts []Conflict
+	for _, existing := range ruleList {
+		other := existing.Conditions.DescriptionContains
+		if other == "" || existing.Actions.CategoryID == 0 || existing.Actions.CategoryID == rule.Actions.CategoryID {
+			continue
+		}
+
+		a, b := keyword, other
+		if rule.Conditions.CaseInsensitive || existing.Conditions.CaseInsensitive {
+			a, b = strings.ToUpper(a), strings.ToUpper(b)
+		}
+		// The same keyword is replaced rather than conflicting
+		if keyword == other || (!strings.Contains(a, b) && !strings.Contains(b, a)) {
+			continue
+		}
+
+		conflicts = append(conflicts, Conflict{Rule: existing, CheckedFirst: compare(existing, rule) < 0})
+	}
+	return conflicts
+}
+
+// Evaluate checks a transaction against rules sorted by priority and combines the actions of those that match.
+// Conditions are always checked against the original description, not one rewritten by another rule
+func Evaluate(rules []types.Rule, transaction Transaction) Result {
+	result := Result{Description: transaction.Description}
+
+	for i := range rules {
+		rule := &rules[i]
+		if !Matches(*rule, transaction) {
+			continue
+		}
+		result.Matched = append(result.Matched, *rule)
+
+		actions := rule.Actions
+		if actions.CategoryID != 0 && result.CategoryRule == nil {
+			result.CategoryID = actions.CategoryID
+			result.CategoryRule = rule
+		}
+		if actions.RewriteDescription != "" && result.DescriptionRule == nil {
+			result.Description = actions.RewriteDescription
+			result.DescriptionRule = rule
+		}
+		if actions.Tag != "" && !slices.Contains(result.Tags, actions.Tag) {
+			result.Tags = append(result.Tags, actions.Tag)
+		}
+		result.Transfer = result.Transfer || actions.MarkTransfer
+		if actions.IgnoreTransaction && result.IgnoreRule == nil {
+			result.IgnoreRule = rule
+		}
+	}
+
+	return result
+}
+
+// Matches reports whether a transaction meets every condition of a rule
+func Matches(rule types.Rule, transaction Transaction) bool {
+	c := rule.Conditions
+
+	description := transaction.Description
+	compare := func(value string) string { return value }
+	if c.CaseInsensitive {
+		compare = strings.ToUpper
+	}
+
+	if c.DescriptionExact != "" && compare(description) != compare(c.DescriptionExact) {
+		return false
+	}
+	if c.DescriptionContains != "" && !strings.Contains(compare(description), compare(c.DescriptionContains)) {
+		return false
+	}
+	if c.DescriptionStartsWith != "" && !strings.HasPrefix(compare(description), compare(c.DescriptionStartsWith)) {
+		return false
+	}
+	if c.DescriptionRegex != "" {
+		pattern, err := compileRegex(c.DescriptionRegex, c.CaseInsensitive)
+		if err != nil || !pattern.MatchString(description) {
+			return false
+		}
+	}
+
+	// Amounts are compared to the cent
+	if c.AmountMin != nil && transaction.Amount < *c.AmountMin-amountTolerance {
+		return false
+	}
+	if c.AmountMax != nil && transaction.Amount > *c.AmountMax+amountTolerance {
+		return false
+	}
+	if c.Direction == types.DirectionIncome && transaction.Amount <= 0 {
+		return false
+	}
+	if c.Direction == types.DirectionExpense && transaction.Amount >= 0 {
+		return false
+	}
+
+	if c.AccountID != 0 && transaction.AccountID != c.AccountID {
+		return false
+	}
+	if c.PayeeID != 0 && transaction.PayeeID != c.PayeeID {
+		return false
+	}
+
+	day := transaction.Date.Format("2006-01-02")
+	if c.DateFrom != nil && day < c.DateFrom.Format("2006-01-02") {
+		return false
+	}
+	if c.DateTo != nil && day > c.DateTo.Format("2006-01-02") {
+		return false
+	}
+
+	return true
+}
+
+// Validate checks that a rule has at least one condition and one action and that its regex compiles
+func Validate(rule types.Rule) error {
+	c, a := rule.Conditions, rule.Actions
+	hasCondition := c.DescriptionExact != "" || c.DescriptionContains != "" || c.DescriptionStartsWith != "" ||
+		c.DescriptionRegex != "" || c.AmountMin != nil || c.AmountMax != nil || c.AccountID != 0 ||
+		c.DateFrom != nil || c.DateTo != nil || c.Direction != "" || c.PayeeID != 0
+	if !hasCondition {
+		return fmt.Errorf("rule needs at least one condition")
+	}
+	hasAction := a.CategoryID != 0 || a.RewriteDescription != "" || a.Tag != "" || a.MarkTransfer || a.IgnoreTransaction
+	if !hasAction {
+		return fmt.Errorf("rule needs at least one action")
+	}
+	if c.DescriptionRegex != "" {
+		if _, err := compileRegex(c.DescriptionRegex, c.CaseInsensitive); err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+	}
+	if c.Direction != "" && c.Direction != types.DirectionIncome && c.Direction != types.DirectionExpense {
+		return fmt.Errorf("direction must be '%s' or '%s'", types.DirectionIncome, types.DirectionExpense)
+	}
+	return nil
+}
+
+// FromSpecialRule turns a special rule from the import config into a rule limited to the format's account.
+// It has no ID since it isn't stored
+func FromSpecialRule(special types.SpecialRule, accountID int, categoryID int) types.Rule {
+	return types.Rule{
+		Priority: SpecialRulePriority,
+		Conditions: types.RuleConditions{
+			DescriptionExact: special.DescriptionExact,
+			AmountMin:        special.AmountExact,
+			AmountMax:        special.AmountExact,
+			AccountID:        accountID,
+		},
+		Actions: types.RuleActions{CategoryID: categoryID, CategoryName: special.ForceCategory},
+	}
+}
+
+// Label names a rule for reports, e.g. "rule 4 (description contains 'AMAZON')". Special rules
+// from the import config are named by their description
+func Label(rule types.Rule) string {
+	if rule.ID == 0 {
+		return fmt.Sprintf("special rule '%s'", rule.Conditions.DescriptionExact)
+	}
+	return fmt.Sprintf("rule %d (%s)", rule.ID, Describe(rule))
+}
+
+// Describe summarizes a rule's conditions, e.g. `description contains 'AMAZON' and expense only`
+func Describe(rule types.Rule) string {
+	c := rule.Conditions
+	var parts []string
+
+	quote := func(value string) string {
+		if c.CaseInsensitive {
+			return fmt.Sprintf("'%s' (any case)", value)
+		}
+		return fmt.Sprintf("'%s'", value)
+	}
+	if c.PayeeName != "" {
+		parts = append(parts, "payee is "+c.PayeeName)
+	} else if c.PayeeID != 0 {
+		parts = append(parts, fmt.Sprintf("payee %d", c.PayeeID))
+	}
+	if c.DescriptionExact != "" {
+		parts = append(parts, "description is "+quote(c.DescriptionExact))
+	}
+	if c.DescriptionContains != "" {
+		parts = append(parts, "description contains "+quote(c.DescriptionContains))
+	}
+	if c.DescriptionStartsWith != "" {
+		parts = append(parts, "description starts with "+quote(c.DescriptionStartsWith))
+	}
+	if c.DescriptionRegex != "" {
+		parts = append(parts, "description matches /"+c.DescriptionRegex+"/")
+	}
+
+	switch {
+	case c.AmountMin != nil && c.AmountMax != nil && *c.AmountMin == *c.AmountMax:
+		parts = append(parts, fmt.Sprintf("amount is %.2f", *c.AmountMin))
+	case c.AmountMin != nil && c.AmountMax != nil:
+		parts = append(parts, fmt.Sprintf("amount between %.2f and %.2f", *c.AmountMin, *c.AmountMax))
+	case c.AmountMin != nil:
+		parts = append(parts, fmt.Sprintf("amount at least %.2f", *c.AmountMin))
+	case c.AmountMax != nil:
+		parts = append(parts, fmt.Sprintf("amount at most %.2f", *c.AmountMax))
+	}
+	if c.Direction != "" {
+		parts = append(parts, c.Direction+" only")
+	}
+
+	if c.AccountName != "" {
+		parts = append(parts, "account is "+c.AccountName)
+	} else if c.AccountID != 0 {
+		parts = append(parts, fmt.Sprintf("account %d", c.AccountID))
+	}
+
+	switch {
+	case c.DateFrom != nil && c.DateTo != nil:
+		parts = append(parts, fmt.Sprintf("dated %s to %s", c.DateFrom.Format("2006-01-02"), c.DateTo.Format("2006-01-02")))
+	case c.DateFrom != nil:
+		parts = append(parts, "dated from "+c.DateFrom.Format("2006-01-02"))
+	case c.DateTo != nil:
+		parts = append(parts, "dated until "+c.DateTo.Format("2006-01-02"))
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+// DescribeActions summarizes what a rule does, e.g. `category Groceries, tag 'costco'`
+func DescribeActions(rule types.Rule) string {
+	a := rule.Actions
+	var parts []string
+
+	if a.CategoryName != "" {
+		parts = append(parts, "category "+a.CategoryName)
+	} else if a.CategoryID != 0 {
+		parts = append(parts, fmt.Sprintf("category %d", a.CategoryID))
+	}
+	if a.RewriteDescription != "" {
+		parts = append(parts, fmt.Sprintf("rename to '%s'", a.RewriteDescription))
+	}
+	if a.Tag != "" {
+		parts = append(parts, fmt.Sprintf("tag '%s'", a.Tag))
+	}
+	if a.MarkTransfer {
+		parts = append(parts, "mark as transfer")
+	}
+	if a.IgnoreTransaction {
+		parts = append(parts, "ignore on import")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// compileRegex compiles a rule's regular expression once and reuses it afterwards
+func compileRegex(pattern string, caseInsensitive bool) (*regexp.Regexp, error) {
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	if cached, ok := regexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, compiled)
+	return compiled, nil
+}
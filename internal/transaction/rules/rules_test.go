@@ -0,0 +1,261 @@
+package rules
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// contains builds a rule that sets a category for descriptions containing a keyword
+func contains(id int, priority int, keyword string, categoryID int) types.Rule {
+	return types.Rule{
+		ID:         id,
+		Priority:   priority,
+		Conditions: types.RuleConditions{DescriptionContains: keyword},
+		Actions:    types.RuleActions{CategoryID: categoryID},
+	}
+}
+
+// ruleIDs lists the IDs of rules in order
+func ruleIDs(ruleList []types.Rule) []int {
+	var ids []int
+	for _, rule := range ruleList {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+// amount returns a pointer for an amount condition
+func amount(value float64) *float64 {
+	return &value
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []types.Rule
+		want  []int
+	}{
+		{
+			name:  "highest priority first",
+			rules: []types.Rule{contains(1, 0, "A", 1), contains(2, 10, "A", 1), contains(3, 5, "A", 1)},
+			want:  []int{2, 3, 1},
+		},
+		{
+			name:  "longest description text first within a priority",
+			rules: []types.Rule{contains(1, 0, "AMAZON", 1), contains(2, 0, "AMAZON PRIME", 2), contains(3, 0, "AMZ", 3)},
+			want:  []int{2, 1, 3},
+		},
+		{
+			name:  "priority beats length",
+			rules: []types.Rule{contains(1, 0, "AMAZON PRIME", 1), contains(2, 1, "AMAZON", 2)},
+			want:  []int{2, 1},
+		},
+		{
+			name:  "oldest first when tied",
+			rules: []types.Rule{contains(7, 0, "SHOP", 1), contains(3, 0, "CAFE", 1), contains(5, 0, "BOOK", 1)},
+			want:  []int{3, 5, 7},
+		},
+		{
+			name:  "unsaved rules count as newest",
+			rules: []types.Rule{contains(0, 0, "SHOP", 1), contains(9, 0, "CAFE", 1)},
+			want:  []int{9, 0},
+		},
+		{
+			name: "regular expressions don't count towards length",
+			rules: []types.Rule{
+				{ID: 1, Conditions: types.RuleConditions{DescriptionRegex: "^AMAZON.*PRIME$"}, Actions: types.RuleActions{CategoryID: 1}},
+				contains(2, 0, "AMZ", 2),
+			},
+			want: []int{2, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Sort(tt.rules)
+			if got := ruleIDs(tt.rules); !slices.Equal(got, tt.want) {
+				t.Errorf("order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rename := types.Rule{
+		ID:         1,
+		Priority:   5,
+		Conditions: types.RuleConditions{DescriptionStartsWith: "AMZN MKTP"},
+		Actions:    types.RuleActions{RewriteDescription: "Amazon", Tag: "online"},
+	}
+	prime := contains(2, 0, "AMZN MKTP PRIME", 20)
+	marketplace := contains(3, 0, "AMZN MKTP", 10)
+	renamed := contains(4, 0, "Amazon", 30)
+	large := types.Rule{
+		ID:         5,
+		Conditions: types.RuleConditions{AmountMax: amount(-100)},
+		Actions:    types.RuleActions{Tag: "large", CategoryID: 40},
+	}
+	tagAgain := types.Rule{
+		ID:         6,
+		Conditions: types.RuleConditions{DescriptionContains: "MKTP"},
+		Actions:    types.RuleActions{Tag: "online", MarkTransfer: true, IgnoreTransaction: true},
+	}
+
+	ruleList := []types.Rule{large, renamed, marketplace, prime, rename, tagAgain}
+	Sort(ruleList)
+
+	tests := []struct {
+		name            string
+		transaction     Transaction
+		categoryID      int
+		categoryRule    int
+		description     string
+		descriptionRule int
+		tags            []string
+		transfer        bool
+		ignoreRule      int
+		matched         []int
+	}{
+		{
+			name:            "each action comes from the first rule that has it",
+			transaction:     Transaction{Description: "AMZN MKTP PRIME 123", Amount: -12},
+			categoryID:      20,
+			categoryRule:    2,
+			description:     "Amazon",
+			descriptionRule: 1,
+			tags:            []string{"online"},
+			transfer:        true,
+			ignoreRule:      6,
+			matched:         []int{1, 2, 3, 6},
+		},
+		{
+			name:            "conditions see the original description, not the rewritten one",
+			transaction:     Transaction{Description: "AMZN MKTP 456", Amount: -250},
+			categoryID:      10,
+			categoryRule:    3,
+			description:     "Amazon",
+			descriptionRule: 1,
+			tags:            []string{"online", "large"},
+			transfer:        true,
+			ignoreRule:      6,
+			matched:         []int{1, 3, 6, 5},
+		},
+		{
+			name:        "no match keeps the description",
+			transaction: Transaction{Description: "CORNER SHOP", Amount: -5},
+			description: "CORNER SHOP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Evaluate(ruleList, tt.transaction)
+
+			if result.CategoryID != tt.categoryID {
+				t.Errorf("category %d, want %d", result.CategoryID, tt.categoryID)
+			}
+			if id := resultRuleID(result.CategoryRule); id != tt.categoryRule {
+				t.Errorf("category rule %d, want %d", id, tt.categoryRule)
+			}
+			if result.Description != tt.description {
+				t.Errorf("description %q, want %q", result.Description, tt.description)
+			}
+			if id := resultRuleID(result.DescriptionRule); id != tt.descriptionRule {
+				t.Errorf("description rule %d, want %d", id, tt.descriptionRule)
+			}
+			if !slices.Equal(result.Tags, tt.tags) {
+				t.Errorf("tags %v, want %v", result.Tags, tt.tags)
+			}
+			if result.Transfer != tt.transfer {
+				t.Errorf("transfer %v, want %v", result.Transfer, tt.transfer)
+			}
+			if id := resultRuleID(result.IgnoreRule); id != tt.ignoreRule {
+				t.Errorf("ignore rule %d, want %d", id, tt.ignoreRule)
+			}
+			if got := ruleIDs(result.Matched); !slices.Equal(got, tt.matched) {
+				t.Errorf("matched %v, want %v", got, tt.matched)
+			}
+		})
+	}
+}
+
+// resultRuleID returns the ID of the rule behind a result, 0 when there is none
+func resultRuleID(rule *types.Rule) int {
+	if rule == nil {
+		return 0
+	}
+	return rule.ID
+}
+
+func TestMatches(t *testing.T) {
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	transaction := Transaction{AccountID: 2, Date: jan, Amount: -42.5, Description: "Coffee Shop #12", PayeeID: 7}
+
+	tests := []struct {
+		name       string
+		conditions types.RuleConditions
+		want       bool
+	}{
+		{"exact", types.RuleConditions{DescriptionExact: "Coffee Shop #12"}, true},
+		{"exact is case sensitive", types.RuleConditions{DescriptionExact: "COFFEE SHOP #12"}, false},
+		{"exact any case", types.RuleConditions{DescriptionExact: "COFFEE SHOP #12", CaseInsensitive: true}, true},
+		{"contains", types.RuleConditions{DescriptionContains: "Shop"}, true},
+		{"contains any case", types.RuleConditions{DescriptionContains: "shop", CaseInsensitive: true}, true},
+		{"starts with", types.RuleConditions{DescriptionStartsWith: "Shop"}, false},
+		{"regex", types.RuleConditions{DescriptionRegex: `#\d+$`}, true},
+		{"regex any case", types.RuleConditions{DescriptionRegex: `^coffee`, CaseInsensitive: true}, true},
+		{"invalid regex never matches", types.RuleConditions{DescriptionRegex: `(`}, false},
+		{"amount range", types.RuleConditions{AmountMin: amount(-50), AmountMax: amount(-40)}, true},
+		{"amount to the cent", types.RuleConditions{AmountMin: amount(-42.5), AmountMax: amount(-42.5)}, true},
+		{"amount outside range", types.RuleConditions{AmountMin: amount(-40)}, false},
+		{"expense", types.RuleConditions{Direction: types.DirectionExpense}, true},
+		{"income", types.RuleConditions{Direction: types.DirectionIncome}, false},
+		{"account", types.RuleConditions{AccountID: 2}, true},
+		{"other account", types.RuleConditions{AccountID: 3}, false},
+		{"payee", types.RuleConditions{PayeeID: 7}, true},
+		{"other payee", types.RuleConditions{PayeeID: 8}, false},
+		{"date range", types.RuleConditions{DateFrom: &from, DateTo: &to}, true},
+		{"range ends on the day", types.RuleConditions{DateTo: &jan}, true},
+		{"after the range", types.RuleConditions{DateTo: &from}, false},
+		{"every condition must pass", types.RuleConditions{DescriptionContains: "Coffee", AccountID: 3}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(types.Rule{Conditions: tt.conditions}, transaction); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	existing := []types.Rule{
+		contains(1, 0, "AMAZON", 1),
+		contains(2, 0, "AMAZON PRIME VIDEO", 2),
+		contains(3, 0, "PRIME", 3),
+		contains(4, 0, "AMAZON PRIME", 9),
+		contains(5, 0, "WALMART", 5),
+	}
+
+	conflicts := Conflicts(existing, contains(0, 0, "AMAZON PRIME", 9))
+
+	got := make(map[int]bool)
+	for _, conflict := range conflicts {
+		got[conflict.Rule.ID] = conflict.CheckedFirst
+	}
+	want := map[int]bool{1: false, 2: true, 3: false}
+	if len(got) != len(want) {
+		t.Fatalf("conflicts %v, want %v", got, want)
+	}
+	for id, checkedFirst := range want {
+		if first, ok := got[id]; !ok || first != checkedFirst {
+			t.Errorf("rule %d: conflict %v (checked first %v), want checked first %v", id, ok, first, checkedFirst)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package rules
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/HadeZForge/FortiFi/internal/database"
+	txnUtils "github.com/HadeZForge/FortiFi/internal/transaction/utils"
+	"github.com/HadeZForge/FortiFi/internal/types"
+)
+
+// minSuggestionCount is how many Uncategorized transactions have to share a payee before a rule is suggested
+const minSuggestionCount = 2
+
+// minKeywordLength keeps suggested includes keywords from being so short they match unrelated payees
+const minKeywordLength = 3
+
+// Suggestion is a proposed rule for a cluster of Uncategorized transactions that share a payee. The rule
+// has its conditions and priority but no category yet
+type Suggestion struct {
+	Payee        string
+	Count        int
+	Total        float64
+	Descriptions []string
+	Rule         types.Rule
+}
+
+// Suggest groups the Uncategorized transactions by their normalized description and proposes an exact
+// rule for each group with a single description, or an includes rule with payee words every description
+// contains. Suggestions are ranked by how many transactions they cover, then by the
+// size of their total amount
+func Suggest(db database.DBTX) ([]Suggestion, error) {
+	transactions, err := loadTransactions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make(map[string]*Suggestion)
+	for _, stored := range transactions {
+		if !stored.uncategorized() || stored.CategorySource == types.CategorySourceManual {
+			continue
+		}
+		// Rules match the original description, so suggestions are built from it
+		description := stored.Transaction.Description
+		payee := txnUtils.NormalizeDescription(description)
+		if payee == "" {
+			continue
+		}
+
+		cluster, ok := clusters[payee]
+		if !ok {
+			cluster = &Suggestion{Payee: payee}
+			clusters[payee] = cluster
+		}
+		cluster.Count++
+		cluster.Total += stored.Transaction.Amount
+		if !slices.Contains(cluster.Descriptions, description) {
+			cluster.Descriptions = append(cluster.Descriptions, description)
+		}
+	}
+
+	var suggestions []Suggestion
+	for _, cluster := range clusters {
+		if cluster.Count < minSuggestionCount {
+			continue
+		}
+		conditions, ok := proposeConditions(cluster.Payee, cluster.Descriptions)
+		if !ok {
+			continue
+		}
+
+		cluster.Rule = types.Rule{Priority: database.IncludesRulePriority, Conditions: conditions}
+		if conditions.DescriptionExact != "" {
+			cluster.Rule.Priority = database.ExactRulePriority
+		}
+		suggestions = append(suggestions, *cluster)
+	}
+
+	slices.SortFunc(suggestions, func(a, b Suggestion) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		if c := cmp.Compare(math.Abs(b.Total), math.Abs(a.Total)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Payee, b.Payee)
+	})
+	return suggestions, nil
+}
+
+// proposeConditions picks the description condition for a cluster. Descriptions that are all the same get
+// an exact match, otherwise the longest run of payee words found in every description is used, ignoring
+// case when the descriptions only agree that way
+func proposeConditions(payee string, descriptions []string) (types.RuleConditions, bool) {
+	if len(descriptions) == 1 {
+		return types.RuleConditions{DescriptionExact: descriptions[0]}, true
+	}
+
+	// Leading runs of words first, then single words from longest to shortest for payees written
+	// with punctuation between words, like "SQ *COFFEE"
+	words := strings.Fields(payee)
+	var keywords []string
+	for n := len(words); n > 0; n-- {
+		keywords = append(keywords, strings.Join(words[:n], " "))
+	}
+	single := slices.Clone(words)
+	slices.SortStableFunc(single, func(a, b string) int { return len(b) - len(a) })
+	keywords = append(keywords, single...)
+
+	for _, keyword := range keywords {
+		if len(keyword) < minKeywordLength {
+			continue
+		}
+		if containedInAll(descriptions, keyword, false) {
+			return types.RuleConditions{DescriptionContains: keyword}, true
+		}
+		if containedInAll(descriptions, keyword, true) {
+			return types.RuleConditions{DescriptionContains: keyword, CaseInsensitive: true}, true
+		}
+	}
+	return types.RuleConditions{}, false
+}
+
+// containedInAll reports whether every description contains the keyword
+func containedInAll(descriptions []string, keyword string, caseInsensitive bool) bool {
+	for _, description := range descriptions {
+		if caseInsensitive {
+			description = strings.ToUpper(description)
+		}
+		if !strings.Contains(description, keyword) {
+			return false
+		}
+	}
+	return true
+}
@@ -45,6 +45,24 @@ func FindImportFormat(config *types.ImportConfig, filename string) (*types.Impor
 	return nil, fmt.Errorf("no matching import format found for file: %s", filename)
 }
 
+// FindImportFormatByAccount finds the import format whose account number matches the one
+// in a self-describing statement (OFX ACCTID, camt IBAN). Spaces and case are ignored
+func FindImportFormatByAccount(config *types.ImportConfig, accountNumber string) (*types.ImportFormat, error) {
+	normalized := normalizeAccountNumber(accountNumber)
+
+	for _, format := range config.ImportFormats {
+		if format.AccountNumber != "" && normalizeAccountNumber(format.AccountNumber) == normalized {
+			return &format, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no matching import format found for account number: %s", accountNumber)
+}
+
+func normalizeAccountNumber(accountNumber string) string {
+	return strings.ToUpper(strings.ReplaceAll(accountNumber, " ", ""))
+}
+
 // GetColumnIndex finds the index of a column header in the CSV headers
 func GetColumnIndex(headers []string, columnName string) (int, error) {
 	for i, header := range headers {
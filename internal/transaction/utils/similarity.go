@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SimilarDescriptionThreshold is the DescriptionSimilarity at which two descriptions are treated as the same payee
+const SimilarDescriptionThreshold = 0.5
+
+// descriptionNoiseWords are words banks add around the payee that say nothing about who was paid
+var descriptionNoiseWords = map[string]bool{
+	"PENDING": true, "POS": true, "DEBIT": true, "CREDIT": true, "PURCHASE": true,
+	"CARD": true, "VISA": true, "CHECKCARD": true, "RECURRING": true, "PAYMENT": true,
+	"TRANSACTION": true, "AUTH": true, "ONLINE": true, "THE": true,
+}
+
+// DescriptionSimilarity scores how alike two descriptions are from 0 to 1 by comparing their words,
+// ignoring case, digits, punctuation and noise words like PENDING or POS. A word that starts another
+// word of at least four letters counts as shared, so "AMZN MKTP" matches "AMZN MKTPLACE PMTS"
+func DescriptionSimilarity(a string, b string) float64 {
+	wordsA := descriptionWords(a)
+	wordsB := descriptionWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b)) {
+			return 1
+		}
+		return 0
+	}
+
+	// Count the words of the shorter description found in the longer one
+	if len(wordsA) > len(wordsB) {
+		wordsA, wordsB = wordsB, wordsA
+	}
+	shared := 0
+	for _, word := range wordsA {
+		for _, other := range wordsB {
+			if word == other || sharesPrefix(word, other) {
+				shared++
+				break
+			}
+		}
+	}
+
+	return float64(shared) / float64(len(wordsA))
+}
+
+// descriptionWords splits a description into its distinct uppercase words without digits or noise words
+func descriptionWords(description string) []string {
+	fields := strings.FieldsFunc(strings.ToUpper(description), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	seen := make(map[string]bool)
+	var words []string
+	for _, field := range fields {
+		if len(field) < 2 || descriptionNoiseWords[field] || seen[field] {
+			continue
+		}
+		seen[field] = true
+		words = append(words, field)
+	}
+	return words
+}
+
+// sharesPrefix reports whether one word starts the other and the shorter one has at least four letters
+func sharesPrefix(a string, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= 4 && strings.HasPrefix(b, a)
+}
+
+// regionCodes are the US state and Canadian province codes card descriptions end with after the city
+var regionCodes = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true, "DC": true,
+	"FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true, "KS": true, "KY": true,
+	"LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true, "MS": true, "MO": true, "MT": true,
+	"NE": true, "NV": true, "NH": true, "NJ": true, "NM": true, "NY": true, "NC": true, "ND": true, "OH": true,
+	"OK": true, "OR": true, "PA": true, "RI": true, "SC": true, "SD": true, "TN": true, "TX": true, "UT": true,
+	"VT": true, "VA": true, "WA": true, "WV": true, "WI": true, "WY": true,
+	"AB": true, "BC": true, "MB": true, "NB": true, "NL": true, "NS": true, "ON": true, "PE": true, "QC": true, "SK": true,
+}
+
+// NormalizeDescription reduces a description to the words that name the payee so different visits to
+// the same store group together. Words with digits (store numbers, dates, reference codes), noise words
+// and a trailing city with its state or province code are dropped, e.g. "STARBUCKS #1234 SEATTLE WA"
+// becomes "STARBUCKS"
+func NormalizeDescription(description string) string {
+	fields := strings.FieldsFunc(strings.ToUpper(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '&' && r != '\''
+	})
+
+	var words []string
+	for _, field := range fields {
+		if len(field) < 2 || descriptionNoiseWords[field] || strings.IndexFunc(field, unicode.IsDigit) >= 0 {
+			continue
+		}
+		words = append(words, field)
+	}
+
+	// Only strip the city when a payee word is left in front of it
+	if n := len(words); n >= 3 && regionCodes[words[n-1]] {
+		words = words[:n-2]
+	}
+
+	return strings.Join(words, " ")
+}
@@ -19,6 +19,8 @@ func CompareFloats(a, b float64) bool {
 	return roundToTwoDecimalPlaces(a) == roundToTwoDecimalPlaces(b)
 }
 
+// GenerateTransactionHash builds the dedupe fingerprint of a transaction from its content.
+// It doesn't include the account, see GenerateTransactionID
 func GenerateTransactionHash(transactionDate time.Time, amount float64, description string, dailySequence int) string {
 	// Create a string representation of the transaction with daily sequence
 	transactionString := fmt.Sprintf("%s|%.2f|%s|%d",
@@ -32,6 +34,26 @@ func GenerateTransactionHash(transactionDate time.Time, amount float64, descript
 	return fmt.Sprintf("%x", hash)
 }
 
+// GenerateExternalTransactionHash builds the dedupe fingerprint of a transaction from an institution
+// supplied identifier (e.g. an OFX FITID). It is only unique within an account, which GenerateTransactionID
+// takes care of, so renaming the account doesn't change it
+func GenerateExternalTransactionHash(externalID string) string {
+	transactionString := fmt.Sprintf("external|%s", externalID)
+
+	hash := sha256.Sum256([]byte(transactionString))
+	return fmt.Sprintf("%x", hash)
+}
+
+// GenerateTransactionID builds a transaction's ID from its account and its dedupe fingerprint.
+// Fingerprints only need to be unique within an account, so the same purchase on the same day
+// in two accounts gets two different IDs
+func GenerateTransactionID(accountID int, fingerprint string) string {
+	transactionString := fmt.Sprintf("account|%d|%s", accountID, fingerprint)
+
+	hash := sha256.Sum256([]byte(transactionString))
+	return fmt.Sprintf("%x", hash)
+}
+
 // Helper function to get the next daily sequence for identical transactions
 func GetNextDailySequence(db *sql.DB, transactionDate time.Time, amount float64, description string) (int, error) {
 	// Query to find all existing transactions with the same date, amount, and description
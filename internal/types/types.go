@@ -18,6 +18,7 @@ type Command struct {
 	Name        string
 	Description string
 	Handler     func(*sql.DB, *bufio.Reader)
+	ArgHandler  func(*sql.DB, *bufio.Reader, string) // Optional, runs when the tag is followed by an argument
 }
 
 type CategoryInfo struct {
@@ -26,6 +27,13 @@ type CategoryInfo struct {
 	Id               int
 }
 
+// CategoryNode is a category and the category it belongs under, 0 for top-level categories
+type CategoryNode struct {
+	ID       int
+	Name     string
+	ParentID int
+}
+
 type TimelineEntry struct {
 	Month string
 	Total float64
@@ -39,6 +47,7 @@ type ImportConfig struct {
 // ImportFormat defines how to parse a specific CSV format
 type ImportFormat struct {
 	Identifier        string        `json:"identifier"`
+	AccountNumber     string        `json:"account_number,omitempty"`
 	AccountName       string        `json:"account_name"`
 	ColumnMapping     ColumnMapping `json:"column_mapping"`
 	DateFormat        string        `json:"date_format"`
@@ -47,14 +56,41 @@ type ImportFormat struct {
 	BlacklistExact    []string      `json:"blacklist_exact"`
 	BlacklistContains []string      `json:"blacklist_contains"`
 	SpecialRules      []SpecialRule `json:"special_rules"`
+	DebitTypeValues   []string      `json:"debit_type_values,omitempty"`
+	CreditTypeValues  []string      `json:"credit_type_values,omitempty"`
+	MoneyFormat       MoneyFormat   `json:"money_format"`
+	Delimiter         string        `json:"delimiter,omitempty"`
+	Encoding          string        `json:"encoding,omitempty"`
+	SkipLines         int           `json:"skip_lines,omitempty"`
+	FindHeader        bool          `json:"find_header,omitempty"`
+	SkipFooterLines   int           `json:"skip_footer_lines,omitempty"`
+	FooterMarkers     []string      `json:"footer_markers,omitempty"`
+	// DuplicateWindowDays is how many days apart probable duplicates can be, 0 uses the default and -1 turns the check off
+	DuplicateWindowDays int `json:"duplicate_window_days,omitempty"`
+}
+
+// MoneyFormat describes how amounts and balances are written in a CSV
+type MoneyFormat struct {
+	DecimalSeparator    string   `json:"decimal_separator,omitempty"`
+	ThousandsSeparator  string   `json:"thousands_separator,omitempty"`
+	CurrencySymbols     []string `json:"currency_symbols,omitempty"`
+	ParenthesesNegative bool     `json:"parentheses_negative,omitempty"`
+	TrailingMinus       bool     `json:"trailing_minus,omitempty"`
 }
 
 // ColumnMapping defines which CSV columns map to which transaction fields
 type ColumnMapping struct {
 	Date        string `json:"date"`
 	Description string `json:"description"`
-	Amount      string `json:"amount"`
+	Amount      string `json:"amount,omitempty"`
+	Debit       string `json:"debit,omitempty"`
+	Credit      string `json:"credit,omitempty"`
+	Type        string `json:"type,omitempty"`
 	Balance     string `json:"balance,omitempty"`
+	// DescriptionTemplate builds the description from several columns, e.g. "{Payee} - {Memo}"
+	DescriptionTemplate string `json:"description_template,omitempty"`
+	// Metadata maps metadata field names to extra columns stored with each transaction
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // SpecialRule defines special processing rules for specific transactions
@@ -64,6 +100,49 @@ type SpecialRule struct {
 	ForceCategory    string   `json:"force_category"`
 }
 
+// Rule changes transactions whose details meet all of its conditions. Rules with a higher
+// priority are checked first
+type Rule struct {
+	ID         int
+	Priority   int
+	Conditions RuleConditions
+	Actions    RuleActions
+}
+
+// Directions a rule can require of a transaction's amount
+const (
+	DirectionIncome  = "income"
+	DirectionExpense = "expense"
+)
+
+// RuleConditions are the checks a transaction has to pass for a rule to match. Empty conditions always pass
+type RuleConditions struct {
+	DescriptionExact      string
+	DescriptionContains   string
+	DescriptionStartsWith string
+	DescriptionRegex      string
+	CaseInsensitive       bool
+	AmountMin             *float64
+	AmountMax             *float64
+	AccountID             int
+	AccountName           string // Filled in when rules are loaded, for display
+	DateFrom              *time.Time
+	DateTo                *time.Time
+	Direction             string
+	PayeeID               int
+	PayeeName             string // Filled in when rules are loaded, for display
+}
+
+// RuleActions are what a rule does to the transactions it matches
+type RuleActions struct {
+	CategoryID         int
+	CategoryName       string // Filled in when rules are loaded, for display
+	RewriteDescription string
+	Tag                string
+	MarkTransfer       bool
+	IgnoreTransaction  bool
+}
+
 // GenericTransaction represents a parsed transaction before database insertion
 type GenericTransaction struct {
 	Date          time.Time
@@ -71,6 +150,27 @@ type GenericTransaction struct {
 	Amount        float64
 	Balance       *float64
 	DailySequence int
+	ExternalID    string
+	Category      string
+	Metadata      map[string]string
+}
+
+// ParsedStatement represents a statement file that carries account level
+// information (e.g. OFX) in addition to its transactions
+type ParsedStatement struct {
+	AccountID      string
+	Transactions   []GenericTransaction
+	ClosingBalance *float64
+	BalanceDate    time.Time
+	Skipped        []SkippedRow
+}
+
+// SkippedRow records a row a parser left out, either because it couldn't be parsed or was blacklisted
+type SkippedRow struct {
+	Row         string
+	Description string
+	Reason      string
+	Blacklisted bool
 }
 
 type TableTransaction struct {
@@ -82,7 +182,110 @@ type TableTransaction struct {
 	Description string
 }
 
+// DuplicatePair is two transactions in the same account that look like the same purchase,
+// such as a pending charge and its posted version from an overlapping export
+type DuplicatePair struct {
+	Existing   TableTransaction
+	Duplicate  TableTransaction
+	Similarity float64
+}
+
+// Category sources record what assigned a transaction's category. Manual categories were picked by
+// the user with chg, spl or add
+const (
+	CategorySourceSpecialRule = "special_rule"
+	CategorySourceFile        = "file"
+	CategorySourceRule        = "rule"
+	CategorySourceDefault     = "default"
+	CategorySourceManual      = "manual"
+)
+
+// CategoryDecision is what assigned a transaction's category and when. RuleID is only set for stored
+// rules, Reason describes the decision as it was made since rules can change later
+type CategoryDecision struct {
+	Source    string
+	RuleID    int
+	Reason    string
+	DecidedAt time.Time
+}
+
+// CategorySuggestion is a category the classifier thinks fits a transaction, with its confidence from 0 to 1
+type CategorySuggestion struct {
+	CategoryID   int
+	CategoryName string
+	Confidence   float64
+}
+
+// Payee is a merchant that transactions are grouped under, however their descriptions are written
+type Payee struct {
+	ID           int
+	Name         string
+	Aliases      []PayeeAlias
+	Transactions int
+}
+
+// PayeeAlias is a cleaned description that belongs to a payee. A prefix alias also matches cleaned
+// descriptions that start with its words
+type PayeeAlias struct {
+	Alias   string
+	PayeeID int
+	Prefix  bool
+}
+
+// PayeeRewrite is a regular expression replaced in raw descriptions before they are cleaned into a payee
+type PayeeRewrite struct {
+	ID          int
+	Pattern     string
+	Replacement string
+}
+
+// Transfer statuses. Suggested transfers were paired automatically and still count as income and spend,
+// confirmed ones are left out of reports and broken ones were rejected by the user
+const (
+	TransferSuggested = "suggested"
+	TransferConfirmed = "confirmed"
+	TransferBroken    = "broken"
+)
+
+// Transfer links money leaving one account with the same amount arriving in another
+type Transfer struct {
+	ID          int
+	Status      string
+	From        TableTransaction
+	FromAccount string
+	To          TableTransaction
+	ToAccount   string
+}
+
+// MetadataField is an extra field stored with a transaction, such as a memo or check number
+type MetadataField struct {
+	Field string
+	Value string
+}
+
+// ImportBatch is a single run of the importer over one file
+type ImportBatch struct {
+	ID               int
+	FileName         string
+	Checksum         string
+	Format           string
+	AccountName      string
+	StartedAt        time.Time
+	CompletedAt      *time.Time
+	RolledBackAt     *time.Time
+	TotalRead        int
+	TotalSkipped     int
+	TotalAdded       int
+	TransactionCount int
+	SnapshotCount    int
+}
+
 // Main project .fortifi config file struct
 type Config struct {
-	DatabasePath string `json:"database_path"`
+	DatabasePath      string `json:"database_path"`
+	RawDirectory      string `json:"raw_directory"`
+	ArchiveDirectory  string `json:"archive_directory"`
+	RejectedDirectory string `json:"rejected_directory"`
+	// TransferWindowDays is how many days apart the two sides of a transfer can be
+	TransferWindowDays int `json:"transfer_window_days,omitempty"`
 }